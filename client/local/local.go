@@ -1394,6 +1394,16 @@ func (lc *Client) GetServeConfig(ctx context.Context) (*ipn.ServeConfig, error)
 	return sc, nil
 }
 
+// FunnelConns returns the Funnel connections that tailscaled is currently
+// handling, oldest first.
+func (lc *Client) FunnelConns(ctx context.Context) ([]ipn.ActiveFunnelConn, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/funnel-conns")
+	if err != nil {
+		return nil, fmt.Errorf("getting funnel conns: %w", err)
+	}
+	return decodeJSON[[]ipn.ActiveFunnelConn](body)
+}
+
 func getServeConfigFromJSON(body []byte) (sc *ipn.ServeConfig, err error) {
 	if err := json.Unmarshal(body, &sc); err != nil {
 		return nil, err
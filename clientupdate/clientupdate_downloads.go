@@ -6,15 +6,118 @@
 package clientupdate
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
 
 	"tailscale.com/clientupdate/distsign"
 )
 
-func (up *Updater) downloadURLToFile(pathSrc, fileDst string) (ret error) {
+// downloadURLToFile downloads the file at pathSrc on the pkgs server to
+// fileDst and verifies its signature, or with FromGitHub, the package of the
+// resolved GitHub release. The download fails early if the server
+// says it's not one of contentTypes; see distsign.Client.SetContentTypes.
+func (up *Updater) downloadURLToFile(pathSrc, fileDst string, contentTypes []string) (ret error) {
+	if up.githubRelease != nil {
+		return up.downloadGitHubAsset(up.githubRelease, fileDst)
+	}
 	c, err := distsign.NewClient(up.Logf, up.PkgsAddr)
 	if err != nil {
 		return err
 	}
-	return c.Download(context.Background(), pathSrc, fileDst)
+	c.SetContentTypes(contentTypes)
+	c.SetMaxAttempts(up.DownloadAttempts)
+	c.SetSegments(up.DownloadSegments)
+	c.SetMaxRate(up.MaxDownloadRate)
+	c.SetQuietProgress(up.QuietProgress)
+	c.SetTLSConfig(up.TLSConfig)
+	c.SetProxy(up.Proxy)
+	c.SetSourceAddr(up.SourceAddr)
+	if debugRedirects() {
+		c.SetRedirectLogf(up.Logf)
+	}
+	if up.DiskSpaceHeadroom >= 0 {
+		c.SetSpaceCheck(up.checkDiskSpace)
+	}
+	if up.OnProgress != nil {
+		c.SetProgressFunc(up.reportDownload)
+	}
+	ctx, cancel := up.context()
+	defer cancel()
+	err = c.Download(ctx, pathSrc, fileDst)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// The partial download is kept, and the next attempt resumes it.
+		return fmt.Errorf("download timed out after %v: %w", up.Timeout, err)
+	}
+	return err
+}
+
+// defaultDiskSpaceHeadroom is the default for Arguments.DiskSpaceHeadroom,
+// which leaves room for unpacking or installing the downloaded package.
+const defaultDiskSpaceHeadroom = 32 << 20
+
+// checkDiskSpace returns an error if the filesystem containing dst has less
+// than size bytes free plus the configured headroom, or fewer free inodes than
+// checkFreeInodes requires. If the free space can't be determined, it logs why
+// and lets the download go ahead.
+func (up *Updater) checkDiskSpace(dst string, size int64) error {
+	dir := filepath.Dir(dst)
+	free, err := freeSpace(dir)
+	if err != nil {
+		up.Logf("could not determine the free disk space in %s, skipping the check: %v", dir, err)
+		return nil
+	}
+	need := uint64(size) + uint64(cmp.Or(up.DiskSpaceHeadroom, defaultDiskSpaceHeadroom))
+	if free < need {
+		return fmt.Errorf("not enough disk space in %s: need %.1f MB, have %.1f MB", dir, float64(need)/1e6, float64(free)/1e6)
+	}
+	inodes, err := freeInodes(dir)
+	if err != nil {
+		// Most likely a filesystem without an inode limit.
+		return nil
+	}
+	return checkFreeInodes(dir, inodes)
+}
+
+// Free inodes that checkDiskSpace requires, one for each file an update
+// creates.
+const (
+	// downloadFiles are the files that downloading a package creates in the
+	// download directory: the partial download, which is renamed to the
+	// package once verified, the signature and the If-Range validator kept
+	// next to it for resuming it, and the package's .sha256 file.
+	downloadFiles = 4
+	// unpackFiles are the new tailscale and tailscaled binaries that a Linux
+	// tarball is unpacked to, which may well be on the same filesystem.
+	unpackFiles = 2
+
+	downloadInodes = downloadFiles + unpackFiles
+)
+
+// checkFreeInodes returns an error if inodes, the number of free inodes in dir,
+// is less than downloadInodes. Small filesystems like tmpfs can run out of
+// inodes well before they run out of bytes.
+func checkFreeInodes(dir string, inodes uint64) error {
+	if inodes < downloadInodes {
+		return fmt.Errorf("not enough free inodes in %s: need %d, have %d", dir, downloadInodes, inodes)
+	}
+	return nil
+}
+
+func (up *Updater) resolveURL(pkgsPath string) (chain []string, size int64, err error) {
+	c, err := distsign.NewClient(up.Logf, up.PkgsAddr)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.SetTLSConfig(up.TLSConfig)
+	c.SetProxy(up.Proxy)
+	c.SetSourceAddr(up.SourceAddr)
+	if debugRedirects() {
+		c.SetRedirectLogf(up.Logf)
+	}
+	ctx, cancel := up.context()
+	defer cancel()
+	return c.ResolveURL(ctx, pkgsPath)
 }
@@ -0,0 +1,54 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build (linux && !android) || windows
+
+package clientupdate
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "tailscale.msi")
+	free, err := freeSpace(filepath.Dir(dst))
+	if err != nil {
+		t.Skipf("free space not available: %v", err)
+	}
+
+	up := &Updater{Arguments: Arguments{Logf: t.Logf}}
+	if err := up.checkDiskSpace(dst, 1<<20); err != nil && free > 1<<30 {
+		t.Errorf("checkDiskSpace with %d bytes free: %v", free, err)
+	}
+	err = up.checkDiskSpace(dst, math.MaxInt64/2)
+	if err == nil || !strings.Contains(err.Error(), "not enough disk space") {
+		t.Errorf("checkDiskSpace for a huge download: got error %v, want not enough disk space", err)
+	}
+	up.DiskSpaceHeadroom = math.MaxInt64 / 2
+	if err := up.checkDiskSpace(dst, 1); err == nil {
+		t.Error("checkDiskSpace with a huge headroom succeeded")
+	}
+}
+
+func TestCheckFreeInodes(t *testing.T) {
+	for _, tt := range []struct {
+		inodes  uint64
+		wantErr bool
+	}{
+		{0, true},
+		{downloadInodes - 1, true},
+		{downloadInodes, false},
+		{1 << 20, false},
+	} {
+		err := checkFreeInodes("/tmp", tt.inodes)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkFreeInodes(%d) = %v; want error: %v", tt.inodes, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "not enough free inodes in /tmp") {
+			t.Errorf("checkFreeInodes(%d) = %v; want a not enough free inodes error", tt.inodes, err)
+		}
+	}
+}
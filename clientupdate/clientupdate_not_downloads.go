@@ -5,6 +5,12 @@
 
 package clientupdate
 
-func (up *Updater) downloadURLToFile(pathSrc, fileDst string) (ret error) {
+import "errors"
+
+func (up *Updater) downloadURLToFile(pathSrc, fileDst string, contentTypes []string) (ret error) {
 	panic("unreachable")
 }
+
+func (up *Updater) resolveURL(pkgsPath string) (chain []string, size int64, err error) {
+	return nil, 0, errors.ErrUnsupported
+}
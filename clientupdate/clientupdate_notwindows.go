@@ -5,6 +5,33 @@
 
 package clientupdate
 
+import "os"
+
+// isRoot reports whether the process runs as root.
+func isRoot() bool {
+	return os.Geteuid() == 0
+}
+
 func (up *Updater) updateWindows() error {
 	panic("unreachable")
 }
+
+func (up *Updater) installMSIFromFile(msiTarget string) error {
+	panic("unreachable")
+}
+
+func (up *Updater) rollbackWindows() error {
+	panic("unreachable")
+}
+
+func msiCacheDir() (string, error) {
+	panic("unreachable")
+}
+
+func rebootRequired() (ver string, ok bool) {
+	return "", false
+}
+
+func verifyAuthenticode(path string) error {
+	panic("unreachable")
+}
@@ -7,18 +7,25 @@
 package clientupdate
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"tailscale.com/envknob"
+	"tailscale.com/types/opt"
 	"tailscale.com/util/winutil"
 	"tailscale.com/util/winutil/authenticode"
 )
@@ -34,8 +41,45 @@
 	// It is used to re-launch the GUI process (tailscale-ipn.exe) after
 	// install is complete.
 	winExePathEnv = "TS_UPDATE_WIN_EXE_PATH"
+	// winTrackEnv is the environment variable that is set along with
+	// winMSIEnv and carries the track the update was made from, which the
+	// product code of the version to uninstall for a downgrade is computed
+	// with.
+	winTrackEnv = "TS_UPDATE_WIN_TRACK"
+	// winKeepDownloadEnv is the environment variable that is set along with
+	// winMSIEnv and carries Arguments.KeepDownload, which decides what is
+	// left in the MSI cache after the install.
+	winKeepDownloadEnv = "TS_UPDATE_WIN_KEEP_DOWNLOAD"
+	// winReinstallEnv is the environment variable that is set along with
+	// winMSIEnv and carries Arguments.Reinstall, which makes msiexec install
+	// the MSI again although its version is already installed.
+	winReinstallEnv = "TS_UPDATE_WIN_REINSTALL"
+	// winDownloadDirEnv is the environment variable that is set along with
+	// winMSIEnv and carries Arguments.DownloadDir, which the install step
+	// reads like any $TS_UPDATE_DOWNLOAD_DIR, to leave the MSI in a download
+	// directory chosen by the user.
+	winDownloadDirEnv = "TS_UPDATE_DOWNLOAD_DIR"
+	// winMSISHA256Env is the environment variable that is set along with
+	// winMSIEnv and carries the hex SHA-256 digest of the MSI computed after
+	// its authenticode signature was verified. The final install step only
+	// runs msiexec on a file that still has it, as the MSI cache can change
+	// between the calling process exiting and the copy running, such as
+	// by a racing update.
+	winMSISHA256Env = "TS_UPDATE_WIN_MSI_SHA256"
+	// winSimulateEnv is the hidden environment variable that, if set, makes
+	// the final install step print the msiexec command lines it would run
+	// instead of running them, and run in-process instead of from a copy of
+	// tailscale.exe, so that the Windows update flow can be tested.
+	winSimulateEnv = "TS_UPDATE_SIMULATE"
 )
 
+// updaterCopyGlob matches the copies of tailscale.exe made by makeSelfCopy.
+var updaterCopyGlob = filepath.Join(os.TempDir(), "tailscale-updater-*.exe")
+
+// makeSelfCopy copies the running tailscale.exe to a temporary file, to run
+// the final install step from while the original is replaced. The copy is
+// marked to be deleted at the next reboot, as it's still running when this
+// process exits.
 func makeSelfCopy() (origPathExe, tmpPathExe string, err error) {
 	selfExe, err := os.Executable()
 	if err != nil {
@@ -50,14 +94,23 @@ func makeSelfCopy() (origPathExe, tmpPathExe string, err error) {
 	if err != nil {
 		return "", "", err
 	}
+	defer func() {
+		if err != nil {
+			os.Remove(f2.Name())
+		}
+	}()
 	if err := markTempFileWindows(f2.Name()); err != nil {
+		f2.Close()
 		return "", "", err
 	}
 	if _, err := io.Copy(f2, f); err != nil {
 		f2.Close()
 		return "", "", err
 	}
-	return selfExe, f2.Name(), f2.Close()
+	if err := f2.Close(); err != nil {
+		return "", "", err
+	}
+	return selfExe, f2.Name(), nil
 }
 
 func markTempFileWindows(name string) error {
@@ -71,8 +124,120 @@ func verifyAuthenticode(path string) error {
 	return authenticode.Verify(path, certSubjectTailscale)
 }
 
+// skipSelfAuthenticode, if set, makes installMSIFromFile run the final
+// install step from its copy of tailscale.exe without checking that the copy
+// is signed, for testing updates with unsigned development builds.
+var skipSelfAuthenticode = envknob.RegisterBool("TS_UPDATE_SKIP_SELF_AUTHENTICODE")
+
+// Exit statuses of msiexec that installMSI tells apart; see
+// https://learn.microsoft.com/en-us/windows/win32/msi/error-codes.
+const (
+	msiUserExit          = 1602 // ERROR_INSTALL_USEREXIT
+	msiAlreadyRunning    = 1618 // ERROR_INSTALL_ALREADY_RUNNING
+	msiPackageOpenFailed = 1619 // ERROR_INSTALL_PACKAGE_OPEN_FAILED
+	msiPackageInvalid    = 1620 // ERROR_INSTALL_PACKAGE_INVALID
+	msiRebootRequired    = 3010 // ERROR_SUCCESS_REBOOT_REQUIRED
+)
+
+// msiFailure is how installMSI handles a failed msiexec install.
+type msiFailure int
+
+const (
+	// msiMaybeDowngrade is a failure that may be from installing an older
+	// version, which msiexec won't do over a newer one. The current version
+	// is uninstalled and the install tried again.
+	msiMaybeDowngrade msiFailure = iota
+	// msiNeedsReboot is an install that succeeded, but needs a reboot to
+	// complete.
+	msiNeedsReboot
+	// msiPackageLocked is msiexec failing to open the MSI, usually because
+	// antivirus software scanning the fresh download has it locked. The
+	// install is tried again after a while.
+	msiPackageLocked
+	// msiNoRetry is a failure that neither uninstalling nor waiting fixes,
+	// like a corrupt MSI or the user canceling.
+	msiNoRetry
+)
+
+// classifyMSIFailure returns how installMSI handles err from an msiexec
+// install.
+func classifyMSIFailure(err error) msiFailure {
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		// msiexec didn't run at all.
+		return msiNoRetry
+	}
+	switch ee.ExitCode() {
+	case msiRebootRequired:
+		return msiNeedsReboot
+	case msiPackageOpenFailed:
+		return msiPackageLocked
+	case msiUserExit, msiAlreadyRunning, msiPackageInvalid:
+		return msiNoRetry
+	}
+	return msiMaybeDowngrade
+}
+
+// msiLockedAttempts is the number of times that a locked MSI is tried before
+// giving up, and msiLockedRetryDelay how long to wait in between. Vars for
+// tests.
+var (
+	msiLockedAttempts   = 5
+	msiLockedRetryDelay = 3 * time.Second
+)
+
+// waitForMSIUnlocked waits until msi can be opened, in case antivirus
+// software scanning the fresh download has it locked, for up to
+// msiLockedAttempts tries.
+func (up *Updater) waitForMSIUnlocked(msi string) error {
+	for attempt := 1; ; attempt++ {
+		f, err := os.Open(msi)
+		if err == nil {
+			f.Close()
+			return nil
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s is gone after it was downloaded, which antivirus software quarantining it can cause: %w; consider excluding %s from scanning", msi, err, filepath.Dir(msi))
+		}
+		if !isSharingViolation(err) {
+			return err
+		}
+		if attempt >= msiLockedAttempts {
+			return msiLockedError(msi, err)
+		}
+		up.Logf("%s is locked by another process, possibly antivirus software; retrying in %v", msi, msiLockedRetryDelay)
+		time.Sleep(msiLockedRetryDelay)
+	}
+}
+
+// isSharingViolation reports whether err is from a file being locked by
+// another process.
+func isSharingViolation(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
+
+// msiLockedError returns the error for msi staying locked by another process.
+func msiLockedError(msi string, err error) error {
+	return fmt.Errorf("%s stayed locked by another process, likely antivirus software: %w; consider excluding %s from scanning", msi, err, filepath.Dir(msi))
+}
+
+// msiLogKeep is the number of msiexec logs kept in the MSICache directory,
+// including the latest one.
+const msiLogKeep = 5
+
+// msiLogPath returns the path of a new verbose msiexec log for op, like
+// "install" or "uninstall", in dir.
+func msiLogPath(dir, op string, now time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.log", op, now.Format("20060102-150405.000")))
+}
+
 func (up *Updater) updateWindows() error {
 	if msi := os.Getenv(winMSIEnv); msi != "" {
+		if track := os.Getenv(winTrackEnv); track != "" {
+			up.Track = track
+		}
+		up.KeepDownload = opt.Bool(os.Getenv(winKeepDownloadEnv))
+		up.Reinstall, _ = strconv.ParseBool(os.Getenv(winReinstallEnv))
 		// stdout/stderr from this part of the install could be lost since the
 		// parent tailscaled is replaced. Create a temp log file to have some
 		// output to debug with in case update fails.
@@ -83,121 +248,393 @@ func (up *Updater) updateWindows() error {
 			defer close.Close()
 		}
 
+		if err := up.waitForMSIUnlocked(msi); err != nil {
+			up.Logf("not installing %v: %v", msi, err)
+			return err
+		}
+		if err := checkSHA256(msi, os.Getenv(winMSISHA256Env)); err != nil {
+			up.Logf("not installing %v: %v", msi, err)
+			return fmt.Errorf("not installing %v, which may not have been verified: %w", msi, err)
+		}
 		up.Logf("installing %v ...", msi)
-		if err := up.installMSI(msi); err != nil {
+		err = up.installMSI(msi)
+		rebootRequired := errors.Is(err, ErrRebootRequired)
+		if err != nil && !rebootRequired {
+			// Keep the MSI cache as is, so that the next attempt can
+			// reuse or resume the download.
 			up.Logf("MSI install failed: %v", err)
 			return err
 		}
 
-		up.Logf("success.")
-		return nil
+		if rebootRequired {
+			up.Logf("Update installed; a reboot is required to complete it.")
+			// The "tailscale update" that started this has exited, so
+			// leave a note for the next one, and for "update status".
+			if dir, err := msiCacheDir(); err != nil {
+				up.Logf("failed to record the required reboot: %v", err)
+			} else if err := writeRebootMarker(dir, msi); err != nil {
+				up.Logf("failed to record the required reboot: %v", err)
+			}
+		} else {
+			up.Logf("success.")
+		}
+		up.cleanUpMSICache(msi)
+		// This process runs from a copy made by makeSelfCopy, which can't
+		// be removed while it runs, but copies left by earlier updates that
+		// weren't followed by a reboot can.
+		// Glob next to self, rather than with updaterCopyGlob, so that
+		// the paths are spelled the same way as self.
+		if self, err := os.Executable(); err == nil {
+			up.pruneOldDownloads(filepath.Join(filepath.Dir(self), filepath.Base(updaterCopyGlob)), self, 1)
+		}
+		return err
 	}
 
-	if !winutil.IsCurrentProcessElevated() {
-		return errors.New(`update must be run as Administrator
-
-you can run the command prompt as Administrator one of these ways:
-* right-click cmd.exe, select 'Run as administrator'
-* press Windows+x, then press a
-* press Windows+r, type in "cmd", then press Ctrl+Shift+Enter`)
+	if err := requireRoot(); err != nil {
+		return err
 	}
-	ver, err := requestedTailscaleVersion(up.Version, up.Track)
+	ver, err := up.requestedTailscaleVersion()
 	if err != nil {
 		return err
 	}
-	arch := runtime.GOARCH
-	if arch == "386" {
-		arch = "x86"
-	}
-	if !up.confirm(ver) {
+	pkgsPath := up.windowsMSIPath(ver)
+	if !up.confirmDownload(ver, pkgsPath) {
 		return nil
 	}
 
-	tsDir := filepath.Join(os.Getenv("ProgramData"), "Tailscale")
-	msiDir := filepath.Join(tsDir, "MSICache")
+	msiDir, err := up.downloadDir()
+	if err != nil {
+		return err
+	}
+	msiTarget := filepath.Join(msiDir, path.Base(pkgsPath))
+	if err := up.downloadURLToFile(pkgsPath, msiTarget, msiContentTypes); err != nil {
+		return err
+	}
+	if keep, _ := up.KeepDownload.Get(); keep {
+		if err := writeSHA256File(msiTarget); err != nil {
+			up.Logf("failed to write the checksum of %q: %v", msiTarget, err)
+		}
+	}
+	return up.installMSIFromFile(msiTarget)
+}
+
+// msiCacheDir returns the directory that MSIs are downloaded to,
+// %ProgramData%\Tailscale\MSICache, creating it if needed.
+func msiCacheDir() (string, error) {
+	msiDir := msiCachePath()
+	tsDir := filepath.Dir(msiDir)
 	if fi, err := os.Stat(tsDir); err != nil {
-		return fmt.Errorf("expected %s to exist, got stat error: %w", tsDir, err)
+		return "", fmt.Errorf("expected %s to exist, got stat error: %w", tsDir, err)
 	} else if !fi.IsDir() {
-		return fmt.Errorf("expected %s to be a directory; got %v", tsDir, fi.Mode())
+		return "", fmt.Errorf("expected %s to be a directory; got %v", tsDir, fi.Mode())
 	}
 	if err := os.MkdirAll(msiDir, 0700); err != nil {
-		return err
+		return "", err
 	}
-	up.cleanupOldDownloads(filepath.Join(msiDir, "*.msi"))
-	pkgsPath := fmt.Sprintf("%s/tailscale-setup-%s-%s.msi", up.Track, ver, arch)
-	msiTarget := filepath.Join(msiDir, path.Base(pkgsPath))
-	if err := up.downloadURLToFile(pkgsPath, msiTarget); err != nil {
+	return msiDir, nil
+}
+
+// msiCachePath returns the path of the directory that msiCacheDir returns,
+// without checking for or creating it, for reading what's in it.
+func msiCachePath() string {
+	return filepath.Join(os.Getenv("ProgramData"), "Tailscale", "MSICache")
+}
+
+// rebootMarkerName is the file in the MSI cache that the install step leaves
+// when msiexec says that a reboot is required to complete the install. It
+// holds the installed version, for RebootRequired to report after the
+// "tailscale update" that started the install has exited.
+const rebootMarkerName = "reboot-required"
+
+// writeRebootMarker records in dir that installing msi requires a reboot.
+func writeRebootMarker(dir, msi string) error {
+	var ver string
+	if m := localMSIRE.FindStringSubmatch(filepath.Base(msi)); m != nil {
+		ver = m[1]
+	}
+	return os.WriteFile(filepath.Join(dir, rebootMarkerName), []byte(ver+"\n"), 0644)
+}
+
+func rebootRequired() (ver string, ok bool) {
+	return rebootRequiredIn(msiCachePath(), time.Now().Add(-windows.DurationSinceBoot()))
+}
+
+// rebootRequiredIn is rebootRequired for the reboot marker in dir, and a
+// system that booted at bootTime. A marker from before then is stale, and
+// removed.
+func rebootRequiredIn(dir string, bootTime time.Time) (ver string, ok bool) {
+	marker := filepath.Join(dir, rebootMarkerName)
+	fi, err := os.Stat(marker)
+	if err != nil {
+		return "", false
+	}
+	if fi.ModTime().Before(bootTime) {
+		os.Remove(marker)
+		return "", false
+	}
+	b, err := os.ReadFile(marker)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
+
+// cleanUpMSICache prunes the MSI cache directory containing msi, which was
+// just installed successfully, according to KeepDownload. A DownloadDir is
+// never pruned; only msi itself is removed from it if KeepDownload is false.
+func (up *Updater) cleanUpMSICache(msi string) {
+	dir := filepath.Dir(msi)
+	if up.DownloadDir != "" {
+		if keep, ok := up.KeepDownload.Get(); ok && !keep {
+			os.Remove(msi)
+			os.Remove(msi + ".sha256")
+		}
+		return
+	}
+	if keep, ok := up.KeepDownload.Get(); ok && !keep {
+		up.cleanupOldDownloads(filepath.Join(dir, "tailscale-setup-*.msi"))
+		up.cleanupOldDownloads(filepath.Join(dir, "tailscale-setup-*.msi.sha256"))
+		return
+	}
+	up.pruneOldDownloads(filepath.Join(dir, "tailscale-setup-*.msi"), msi, keptDownloads)
+	up.pruneOldDownloads(filepath.Join(dir, "tailscale-setup-*.msi.sha256"), msi+".sha256", keptDownloads)
+}
+
+// rollbackWindows reinstalls the newest MSI in the MSI cache that is older than
+// the running version, which is normally the one installed before it.
+func (up *Updater) rollbackWindows() error {
+	msiDir := cmp.Or(up.DownloadDir, filepath.Join(os.Getenv("ProgramData"), "Tailscale", "MSICache"))
+	ents, err := os.ReadDir(msiDir)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	var names []string
+	for _, ent := range ents {
+		names = append(names, ent.Name())
+	}
+	name, prev := previousCachedMSI(names, up.currentVersion, runtime.GOARCH)
+	if name == "" {
+		return errNoPreviousVersion
+	}
+	up.LocalFile = filepath.Join(msiDir, name)
+	return up.installPrevious(prev, up.updateFromLocalFile)
+}
 
+// installMSIFromFile verifies the authenticode signature of msiTarget and
+// installs it from a copy of tailscale.exe, exiting the current process.
+func (up *Updater) installMSIFromFile(msiTarget string) error {
+	if os.Getenv(winSimulateEnv) != "" {
+		// Nothing is installed, so there's nothing to verify or to free
+		// tailscale.exe up for.
+		up.Logf("simulating install of %v; skipping authenticode verification and re-exec", msiTarget)
+		up.setPhase(PhaseInstalling)
+		return up.installMSI(msiTarget)
+	}
+	up.setPhase(PhaseVerifying)
+	if err := up.waitForMSIUnlocked(msiTarget); err != nil {
+		return err
+	}
 	up.Logf("verifying MSI authenticode...")
 	if err := verifyAuthenticode(msiTarget); err != nil {
 		return fmt.Errorf("authenticode verification of %s failed: %w", msiTarget, err)
 	}
 	up.Logf("authenticode verification succeeded")
+	// The copy only installs the file verified here; see winMSISHA256Env.
+	digest, err := fileSHA256(msiTarget)
+	if err != nil {
+		return err
+	}
 
 	up.Logf("making tailscale.exe copy to switch to...")
-	up.cleanupOldDownloads(filepath.Join(os.TempDir(), "tailscale-updater-*.exe"))
+	up.cleanupOldDownloads(updaterCopyGlob)
 	selfOrig, selfCopy, err := makeSelfCopy()
 	if err != nil {
 		return err
 	}
-	defer os.Remove(selfCopy)
+	// The copy runs the install elevated, so don't trust it more than the
+	// MSI.
+	if skipSelfAuthenticode() {
+		up.Logf("TS_UPDATE_SKIP_SELF_AUTHENTICODE is set; skipping authenticode verification of %v", selfCopy)
+	} else {
+		up.Logf("verifying tailscale.exe copy authenticode...")
+		if err := verifyAuthenticode(selfCopy); err != nil {
+			os.Remove(selfCopy)
+			return fmt.Errorf("authenticode verification of %s, copied from %s, failed: %w; refusing to run the install from it (set TS_UPDATE_SKIP_SELF_AUTHENTICODE=1 to allow unsigned development builds)", selfCopy, selfOrig, err)
+		}
+		up.Logf("authenticode verification succeeded")
+	}
 	up.Logf("running tailscale.exe copy for final install...")
+	up.setPhase(PhaseInstalling)
 
 	cmd := exec.Command(selfCopy, "update")
-	cmd.Env = append(os.Environ(), winMSIEnv+"="+msiTarget, winExePathEnv+"="+selfOrig)
+	cmd.Env = append(os.Environ(), winMSIEnv+"="+msiTarget, winExePathEnv+"="+selfOrig, winTrackEnv+"="+up.Track, winKeepDownloadEnv+"="+string(up.KeepDownload), winReinstallEnv+"="+strconv.FormatBool(up.Reinstall), winDownloadDirEnv+"="+up.DownloadDir, fmt.Sprintf("%s=%x", winMSISHA256Env, digest))
 	cmd.Stdout = up.Stderr
 	cmd.Stderr = up.Stderr
 	cmd.Stdin = os.Stdin
 	if err := cmd.Start(); err != nil {
+		os.Remove(selfCopy)
 		return err
 	}
 	// Once it's started, exit ourselves, so the binary is free
-	// to be replaced.
+	// to be replaced. Deferred functions don't run on os.Exit, and the copy
+	// is in use by the child anyway; it's removed by the next update or
+	// at the next reboot, as marked by makeSelfCopy.
 	os.Exit(0)
 	panic("unreachable")
 }
 
+// installMSI installs msi, uninstalling the current version first if needed.
+// Verbose msiexec logs are written next to msi.
+//
+// If winSimulateEnv is set, it only logs the msiexec command lines of the
+// install and of the uninstall that follows a failed install.
 func (up *Updater) installMSI(msi string) error {
+	logDir := filepath.Dir(msi)
+	if os.Getenv(winSimulateEnv) != "" {
+		up.Logf("would run: %s", strings.Join(msiInstallCmd(msi, msiLogPath(logDir, "install", time.Now()), up.Reinstall).Args, " "))
+		up.Logf("and if that fails, assuming a downgrade: %s", strings.Join(msiUninstallCmd(up.uninstallTrack(), up.uninstallVersion(), msiLogPath(logDir, "uninstall", time.Now())).Args, " "))
+		return nil
+	}
+	var logPath string
+	defer func() {
+		up.pruneOldDownloads(filepath.Join(logDir, "*install-*.log"), logPath, msiLogKeep)
+	}()
 	var err error
 	for tries := 0; tries < 2; tries++ {
-		cmd := exec.Command("msiexec.exe", "/i", filepath.Base(msi), "/quiet", "/norestart", "/qn")
-		cmd.Dir = filepath.Dir(msi)
-		cmd.Stdout = up.Stdout
-		cmd.Stderr = up.Stderr
-		cmd.Stdin = os.Stdin
-		err = cmd.Run()
+		logPath, err = up.runMSIInstall(msi)
 		if err == nil {
 			break
 		}
-		up.Logf("Install attempt failed: %v", err)
-		uninstallVersion := up.currentVersion
-		if v := os.Getenv("TS_DEBUG_UNINSTALL_VERSION"); v != "" {
-			uninstallVersion = v
+		switch classifyMSIFailure(err) {
+		case msiNeedsReboot:
+			// The install succeeded, so it's not a downgrade to retry as
+			// one; it only needs a reboot.
+			return ErrRebootRequired
+		case msiPackageLocked:
+			up.Logf("msiexec could not open %s; see the msiexec log at %s", msi, logPath)
+			return msiLockedError(msi, err)
+		case msiNoRetry:
+			up.Logf("Install failed: %v; see the msiexec log at %s", err, logPath)
+			return err
 		}
+		up.Logf("Install attempt failed: %v; see the msiexec log at %s", err, logPath)
+		uninstallVersion := up.uninstallVersion()
 		// Assume it's a downgrade, which msiexec won't permit. Uninstall our current version first.
 		up.Logf("Uninstalling current version %q for downgrade...", uninstallVersion)
-		cmd = exec.Command("msiexec.exe", "/x", msiUUIDForVersion(uninstallVersion), "/norestart", "/qn")
+		logPath = msiLogPath(logDir, "uninstall", time.Now())
+		cmd := msiUninstallCmd(up.uninstallTrack(), uninstallVersion, logPath)
 		cmd.Stdout = up.Stdout
 		cmd.Stderr = up.Stderr
 		cmd.Stdin = os.Stdin
 		err = cmd.Run()
 		up.Logf("msiexec uninstall: %v", err)
+		if err != nil {
+			up.Logf("see the msiexec log at %s", logPath)
+		}
 	}
 	return err
 }
 
-func msiUUIDForVersion(ver string) string {
-	arch := runtime.GOARCH
-	if arch == "386" {
-		arch = "x86"
+// runMSIInstall runs msiexec to install msi, with a verbose log next to it,
+// whose path it returns. While msiexec fails to open msi, it tries again, for
+// up to msiLockedAttempts tries.
+func (up *Updater) runMSIInstall(msi string) (logPath string, err error) {
+	for attempt := 1; ; attempt++ {
+		logPath = msiLogPath(filepath.Dir(msi), "install", time.Now())
+		cmd := msiInstallCmd(msi, logPath, up.Reinstall)
+		cmd.Stdout = up.Stdout
+		cmd.Stderr = up.Stderr
+		cmd.Stdin = os.Stdin
+		err = cmd.Run()
+		if err == nil || classifyMSIFailure(err) != msiPackageLocked || attempt >= msiLockedAttempts {
+			return logPath, err
+		}
+		up.Logf("msiexec could not open %s, which may be locked by antivirus software; retrying in %v", msi, msiLockedRetryDelay)
+		time.Sleep(msiLockedRetryDelay)
+	}
+}
+
+// uninstallVersion returns the version that installMSI uninstalls when an
+// install fails: the running one, unless overridden for debugging.
+func (up *Updater) uninstallVersion() string {
+	if v := os.Getenv("TS_DEBUG_UNINSTALL_VERSION"); v != "" {
+		return v
+	}
+	return up.currentVersion
+}
+
+// isRoot reports whether the process is elevated, as updates require.
+func isRoot() bool {
+	return winutil.IsCurrentProcessElevated()
+}
+
+// uninstallTrack returns the track that the version returned by
+// uninstallVersion was installed from, found by looking up its product code
+// for each track among the installed products. That need not be the track
+// this update is made from, such as when switching tracks. It returns "" if
+// neither product code is installed, for the track to be derived from the
+// version instead.
+func (up *Updater) uninstallTrack() string {
+	ver := up.uninstallVersion()
+	for _, track := range []string{StableTrack, UnstableTrack} {
+		if msiProductInstalled(msiUUIDForVersion(track, ver)) {
+			return track
+		}
 	}
-	track, err := versionToTrack(ver)
+	return ""
+}
+
+// msiProductInstalled reports whether the MSI product with the given product
+// code is installed. It's a variable for testing.
+var msiProductInstalled = func(productCode string) bool {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\`+productCode, registry.QUERY_VALUE)
 	if err != nil {
-		track = UnstableTrack
+		return false
+	}
+	k.Close()
+	return true
+}
+
+// msiInstallCmd returns the msiexec command that installs msi, logging to
+// logPath. If reinstall is set, all of msi's files, registry entries and
+// shortcuts are installed again even if its version is already installed,
+// which msiexec otherwise skips.
+func msiInstallCmd(msi, logPath string, reinstall bool) *exec.Cmd {
+	args := []string{"/i", filepath.Base(msi), "/quiet", "/norestart", "/qn", "/l*v", logPath}
+	if reinstall {
+		args = append(args, "REINSTALL=ALL", "REINSTALLMODE=vomus")
+	}
+	cmd := execCommand("msiexec.exe", args...)
+	cmd.Dir = filepath.Dir(msi)
+	return cmd
+}
+
+// msiUninstallCmd returns the msiexec command that uninstalls version ver,
+// installed from track, logging to logPath.
+func msiUninstallCmd(track, ver, logPath string) *exec.Cmd {
+	return execCommand("msiexec.exe", "/x", msiUUIDForVersion(track, ver), "/norestart", "/qn", "/l*v", logPath)
+}
+
+func msiUUIDForVersion(track, ver string) string {
+	return msiUUIDForVersionArch(track, ver, runtime.GOARCH)
+}
+
+// msiUUIDForVersionArch returns the MSI product code of ver for goarch, which
+// msiexec needs to uninstall it. The product code depends on the track the MSI
+// was downloaded from, which can't always be told from ver, as any version can
+// be installed from a track with --version. If track is "", it's derived from
+// ver.
+func msiUUIDForVersionArch(track, ver, goarch string) string {
+	if track == "" {
+		var err error
+		track, err = versionToTrack(ver)
+		if err != nil {
+			track = UnstableTrack
+		}
 	}
-	msiURL := fmt.Sprintf("https://pkgs.tailscale.com/%s/tailscale-setup-%s-%s.msi", track, ver, arch)
+	// The product code is derived from the canonical URL at build time, so
+	// this must not use a mirror from Arguments.PkgsAddr.
+	msiURL := "https://pkgs.tailscale.com/" + msiPath(track, ver, goarch)
 	return "{" + strings.ToUpper(uuid.NewSHA1(uuid.NameSpaceURL, []byte(msiURL)).String()) + "}"
 }
 
@@ -0,0 +1,169 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestMSIUUIDForVersionArch(t *testing.T) {
+	tests := []struct {
+		track  string
+		goarch string
+		want   string
+	}{
+		{goarch: "amd64", want: "{DF104929-A79D-5837-AFF9-1474C34F1F8B}"},
+		{goarch: "386", want: "{98343050-FB62-542B-A4B1-A6387AACD533}"},
+		{goarch: "arm64", want: "{191BAC70-9FE6-5BC4-94DB-23A44EEF161D}"},
+		{track: "stable", goarch: "amd64", want: "{DF104929-A79D-5837-AFF9-1474C34F1F8B}"},
+		// 1.70.0 installed from the unstable track with --version has a
+		// different product code than the one derived from its version.
+		{track: "unstable", goarch: "amd64", want: "{A9267A94-E97D-5419-8E76-227E8FDA2380}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.track+"/"+tt.goarch, func(t *testing.T) {
+			if got := msiUUIDForVersionArch(tt.track, "1.70.0", tt.goarch); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMSILogPath(t *testing.T) {
+	now := time.Date(2024, 3, 5, 14, 7, 9, 123e6, time.UTC)
+	want := filepath.Join(`C:\ProgramData\Tailscale\MSICache`, "install-20240305-140709.123.log")
+	if got := msiLogPath(`C:\ProgramData\Tailscale\MSICache`, "install", now); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestClassifyMSIFailure(t *testing.T) {
+	tests := []struct {
+		code int
+		want msiFailure
+	}{
+		{code: 1603, want: msiMaybeDowngrade}, // ERROR_INSTALL_FAILURE
+		{code: 1638, want: msiMaybeDowngrade}, // ERROR_PRODUCT_VERSION
+		{code: msiUserExit, want: msiNoRetry},
+		{code: msiAlreadyRunning, want: msiNoRetry},
+		{code: msiPackageOpenFailed, want: msiPackageLocked},
+		{code: msiPackageInvalid, want: msiNoRetry},
+		{code: msiRebootRequired, want: msiNeedsReboot},
+	}
+	for _, tt := range tests {
+		err := exec.Command("cmd", "/c", fmt.Sprintf("exit %d", tt.code)).Run()
+		if got := classifyMSIFailure(err); got != tt.want {
+			t.Errorf("classifyMSIFailure(exit %d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+	if got := classifyMSIFailure(exec.ErrNotFound); got != msiNoRetry {
+		t.Errorf("classifyMSIFailure(%v) = %v, want %v", exec.ErrNotFound, got, msiNoRetry)
+	}
+}
+
+func TestWaitForMSIUnlocked(t *testing.T) {
+	oldDelay := msiLockedRetryDelay
+	msiLockedRetryDelay = 0
+	defer func() { msiLockedRetryDelay = oldDelay }()
+
+	dir := t.TempDir()
+	msi := filepath.Join(dir, "tailscale-setup-1.70.0-amd64.msi")
+	if err := os.WriteFile(msi, []byte("not an MSI"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	up := &Updater{Arguments: Arguments{Logf: t.Logf}}
+	if err := up.waitForMSIUnlocked(msi); err != nil {
+		t.Errorf("unlocked MSI: %v", err)
+	}
+
+	// Open it without sharing, like some antivirus software does.
+	name, err := windows.UTF16PtrFromString(msi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = up.waitForMSIUnlocked(msi)
+	windows.CloseHandle(h)
+	if err == nil || !strings.Contains(err.Error(), "consider excluding "+dir) {
+		t.Errorf("locked MSI: got error %v, want one suggesting an exclusion", err)
+	}
+
+	os.Remove(msi)
+	if err := up.waitForMSIUnlocked(msi); err == nil || !strings.Contains(err.Error(), "quarantining") {
+		t.Errorf("missing MSI: got error %v, want one mentioning quarantine", err)
+	}
+}
+
+func TestInstallMSISimulate(t *testing.T) {
+	t.Setenv(winSimulateEnv, "1")
+	dir := t.TempDir()
+	msi := filepath.Join(dir, "tailscale-setup-1.68.2-amd64.msi")
+	if err := os.WriteFile(msi, []byte("not an MSI"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	up := &Updater{
+		Arguments: Arguments{
+			Logf: func(format string, args ...any) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			},
+		},
+		currentVersion: "1.70.0",
+	}
+	// Updating to the stable track, the running version's product code must
+	// still be that of the unstable track it was installed from.
+	up.Track = StableTrack
+	oldInstalled := msiProductInstalled
+	defer func() { msiProductInstalled = oldInstalled }()
+	msiProductInstalled = func(code string) bool {
+		return code == "{A9267A94-E97D-5419-8E76-227E8FDA2380}"
+	}
+	// Simulated, this neither verifies the (unsigned) MSI nor exits.
+	if err := up.installMSIFromFile(msi); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(logs, "\n")
+	for _, want := range []string{
+		"would run: msiexec.exe /i tailscale-setup-1.68.2-amd64.msi /quiet /norestart /qn /l*v " + filepath.Join(dir, "install-"),
+		"msiexec.exe /x " + "{A9267A94-E97D-5419-8E76-227E8FDA2380}" + " /norestart /qn /l*v " + filepath.Join(dir, "uninstall-"),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("logs do not contain %q:\n%s", want, out)
+		}
+	}
+	if logs, _ := filepath.Glob(filepath.Join(dir, "*.log")); len(logs) > 0 {
+		t.Errorf("simulated install wrote msiexec logs: %q", logs)
+	}
+}
+
+func TestRebootRequiredIn(t *testing.T) {
+	dir := t.TempDir()
+	if ver, ok := rebootRequiredIn(dir, time.Now().Add(-time.Hour)); ok {
+		t.Fatalf("without a marker: got %q, true; want false", ver)
+	}
+	if err := writeRebootMarker(dir, filepath.Join(dir, "tailscale-setup-1.70.0-amd64.msi")); err != nil {
+		t.Fatal(err)
+	}
+	if ver, ok := rebootRequiredIn(dir, time.Now().Add(-time.Hour)); !ok || ver != "1.70.0" {
+		t.Errorf("before a reboot: got %q, %v; want 1.70.0, true", ver, ok)
+	}
+	// Rebooted since the marker was written.
+	if ver, ok := rebootRequiredIn(dir, time.Now().Add(time.Minute)); ok {
+		t.Errorf("after a reboot: got %q, true; want false", ver)
+	}
+	if _, err := os.Stat(filepath.Join(dir, rebootMarkerName)); err == nil {
+		t.Error("stale reboot marker was not removed")
+	}
+}
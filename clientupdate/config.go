@@ -0,0 +1,193 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"tailscale.com/version"
+)
+
+// DefaultConfigPath returns the location of the optional update configuration
+// file used to set organization-wide defaults for "tailscale update".
+func DefaultConfigPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "Tailscale", "update.conf")
+	}
+	return "/etc/tailscale/update.conf"
+}
+
+// Config contains organization-wide defaults for updates, read from a
+// configuration file. Values explicitly passed in Arguments take precedence
+// over Config.
+//
+// The file consists of "key=value" lines; empty lines and lines starting
+// with "#" are ignored. Supported keys are:
+//
+//   - mirror: https base URL of the pkgs server to download updates from
+//   - track: default release track, "stable" or "unstable"
+//   - version: version to pin updates to, like "1.54.2", instead of the
+//     latest one on the track; it must be on the track, if that's set too
+//   - allow-downgrade: whether explicitly requesting an older version is
+//     allowed (default true)
+//   - allow-track-switch: whether requesting a track other than the
+//     configured one is allowed (default true)
+type Config struct {
+	// Path is the file that the config was read from.
+	Path string
+
+	Mirror           string
+	Track            string
+	Version          string
+	AllowDowngrade   bool
+	AllowTrackSwitch bool
+}
+
+// ReadConfig reads the update configuration from path. It returns a nil Config
+// and no error if the file does not exist.
+func ReadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseConfig(path, f)
+}
+
+func parseConfig(path string, r io.Reader) (*Config, error) {
+	c := &Config{
+		Path:             path,
+		AllowDowngrade:   true,
+		AllowTrackSwitch: true,
+	}
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key=value, got %q", path, lineNum, line)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		var err error
+		switch k {
+		case "mirror":
+			var u *url.URL
+			u, err = url.Parse(v)
+			switch {
+			case err != nil:
+			case u.Scheme == "" || u.Host == "":
+				err = errors.New("must be an absolute URL")
+			case u.Scheme != "https":
+				// Like --pkg-server without --insecure-pkg-server.
+				err = errors.New("must use https")
+			}
+			c.Mirror = strings.TrimSuffix(v, "/")
+		case "track":
+			switch v := NormalizeTrack(v); v {
+			case StableTrack, UnstableTrack:
+				c.Track = v
+			default:
+				err = errors.New(`must be "stable" or "unstable"`)
+			}
+		case "version":
+			err = validatePinnedVersion(v)
+			c.Version = v
+		case "allow-downgrade":
+			c.AllowDowngrade, err = strconv.ParseBool(v)
+		case "allow-track-switch":
+			c.AllowTrackSwitch, err = strconv.ParseBool(v)
+		default:
+			err = errors.New("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid %q value %q: %w", path, lineNum, k, v, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if c.Version != "" && c.Track != "" {
+		if track, _ := versionToTrack(c.Version); track != c.Track {
+			return nil, fmt.Errorf("%s: pinned version %s is not on the %s track", path, c.Version, c.Track)
+		}
+	}
+	return c, nil
+}
+
+// validatePinnedVersion reports whether v is a full release version, like
+// "1.54.2", as the "version" key of the config requires.
+func validatePinnedVersion(v string) error {
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return errors.New("must be a full version, like 1.54.2")
+	}
+	for _, p := range parts {
+		if n, err := strconv.Atoi(p); err != nil || n < 0 || p != strconv.Itoa(n) {
+			return errors.New("must be a full version, like 1.54.2")
+		}
+	}
+	return nil
+}
+
+// Apply merges c into args and returns the result. Non-empty fields of args
+// take precedence over c. It returns an error if args violate the policy set
+// in c.
+//
+// The version pinned by c is only used if args don't ask for any particular
+// version or track either, that is, if none of Version, Track, LocalFile,
+// Rollback, Reinstall and AllowPrerelease are set; the result's PinnedBy is
+// set when it is.
+func (c *Config) Apply(args Arguments) (Arguments, error) {
+	return c.apply(args, version.Short())
+}
+
+func (c *Config) apply(args Arguments, currentVersion string) (Arguments, error) {
+	if c == nil {
+		return args, nil
+	}
+	// Updates from GitHub don't use the pkgs server, nor any mirror of it.
+	if args.PkgsAddr == "" && !args.FromGitHub {
+		args.PkgsAddr = c.Mirror
+	}
+	// An explicit "latest" overrides the pinned version, but not the track.
+	explicitLatest := NormalizeTrack(args.Version) == "latest"
+	args = args.normalized()
+	if c.Version != "" && !explicitLatest && args.Version == "" && args.Track == "" && args.LocalFile == "" && !args.Rollback && !args.Reinstall && !args.AllowPrerelease {
+		args.Version = c.Version
+		args.PinnedBy = c.Path
+	}
+	if c.Track != "" {
+		if !c.AllowTrackSwitch && args.Track != "" && args.Track != c.Track {
+			return args, fmt.Errorf("switching to the %s track is not allowed by %s", args.Track, c.Path)
+		}
+		if !c.AllowTrackSwitch && args.AllowPrerelease && c.Track != UnstableTrack {
+			return args, fmt.Errorf("installing prereleases from the unstable track is not allowed by %s", c.Path)
+		}
+		if args.Track == "" && args.Version == "" && args.LocalFile == "" && !args.Rollback && !args.Reinstall && !args.AllowPrerelease {
+			args.Track = c.Track
+		}
+	}
+	if !c.AllowDowngrade && args.Version != "" && compareVersions(args.Version, currentVersion) < 0 {
+		return args, fmt.Errorf("downgrading from %s to %s is not allowed by %s", currentVersion, args.Version, c.Path)
+	}
+	if !c.AllowDowngrade && args.Rollback {
+		return args, fmt.Errorf("rolling back is not allowed by %s", c.Path)
+	}
+	return args, nil
+}
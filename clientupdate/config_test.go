@@ -0,0 +1,274 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    *Config
+		wantErr string
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: &Config{Path: "test.conf", AllowDowngrade: true, AllowTrackSwitch: true},
+		},
+		{
+			name: "all-keys",
+			in: `# Org-wide update defaults.
+mirror = https://mirror.example.com/tailscale/
+track=unstable
+
+version=1.55.3
+allow-downgrade=false
+allow-track-switch=0
+`,
+			want: &Config{
+				Path:    "test.conf",
+				Mirror:  "https://mirror.example.com/tailscale",
+				Track:   UnstableTrack,
+				Version: "1.55.3",
+			},
+		},
+		{
+			name:    "partial-version",
+			in:      "version=1.54\n",
+			wantErr: `test.conf:1: invalid "version" value "1.54": must be a full version`,
+		},
+		{
+			name:    "version-suffix",
+			in:      "version=1.54.2-t123\n",
+			wantErr: `test.conf:1: invalid "version" value "1.54.2-t123": must be a full version`,
+		},
+		{
+			name:    "version-off-track",
+			in:      "track=stable\nversion=1.55.3\n",
+			wantErr: "test.conf: pinned version 1.55.3 is not on the stable track",
+		},
+		{
+			name:    "bad-track",
+			in:      "track=beta\n",
+			wantErr: `test.conf:1: invalid "track" value "beta"`,
+		},
+		{
+			name:    "relative-mirror",
+			in:      "mirror=mirror.example.com\n",
+			wantErr: `test.conf:1: invalid "mirror" value "mirror.example.com": must be an absolute URL`,
+		},
+		{
+			name:    "http-mirror",
+			in:      "mirror=http://mirror.example.com\n",
+			wantErr: `test.conf:1: invalid "mirror" value "http://mirror.example.com": must use https`,
+		},
+		{
+			name:    "bad-bool",
+			in:      "\nallow-downgrade=maybe\n",
+			wantErr: `test.conf:2: invalid "allow-downgrade" value "maybe"`,
+		},
+		{
+			name:    "unknown-key",
+			in:      "foo=bar\n",
+			wantErr: `test.conf:1: invalid "foo" value "bar": unknown key`,
+		},
+		{
+			name:    "no-equals",
+			in:      "mirror\n",
+			wantErr: `test.conf:1: expected key=value, got "mirror"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfig("test.conf", strings.NewReader(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want prefix %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	cfg := &Config{
+		Path:             "test.conf",
+		Mirror:           "https://mirror.example.com",
+		Track:            UnstableTrack,
+		AllowDowngrade:   true,
+		AllowTrackSwitch: true,
+	}
+	strict := *cfg
+	strict.AllowDowngrade = false
+	strict.AllowTrackSwitch = false
+	pinned := *cfg
+	pinned.Track = StableTrack
+	pinned.Version = "1.54.2"
+
+	tests := []struct {
+		name    string
+		cfg     *Config
+		args    Arguments
+		want    Arguments
+		wantErr string
+	}{
+		{
+			name: "nil-config",
+			args: Arguments{Track: StableTrack},
+			want: Arguments{Track: StableTrack},
+		},
+		{
+			name: "defaults-from-config",
+			cfg:  cfg,
+			want: Arguments{Track: UnstableTrack, PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name: "flags-win",
+			cfg:  cfg,
+			args: Arguments{Track: StableTrack, PkgsAddr: "https://other.example.com"},
+			want: Arguments{Track: StableTrack, PkgsAddr: "https://other.example.com"},
+		},
+		{
+			name: "from-github-skips-mirror",
+			cfg:  cfg,
+			args: Arguments{FromGitHub: true},
+			want: Arguments{FromGitHub: true, Track: UnstableTrack},
+		},
+		{
+			name: "version-flag-suppresses-config-track",
+			cfg:  cfg,
+			args: Arguments{Version: "1.60.0"},
+			want: Arguments{Version: "1.60.0", PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name: "downgrade-allowed",
+			cfg:  cfg,
+			args: Arguments{Version: "1.50.0"},
+			want: Arguments{Version: "1.50.0", PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name:    "downgrade-disallowed",
+			cfg:     &strict,
+			args:    Arguments{Version: "1.50.0"},
+			wantErr: "downgrading from 1.56.0 to 1.50.0 is not allowed by test.conf",
+		},
+		{
+			name: "rollback-allowed",
+			cfg:  cfg,
+			args: Arguments{Rollback: true},
+			want: Arguments{Rollback: true, PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name:    "rollback-disallowed",
+			cfg:     &strict,
+			args:    Arguments{Rollback: true},
+			wantErr: "rolling back is not allowed by test.conf",
+		},
+		{
+			name: "prerelease-suppresses-config-track",
+			cfg:  cfg,
+			args: Arguments{AllowPrerelease: true},
+			want: Arguments{AllowPrerelease: true, PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name:    "prerelease-disallowed",
+			cfg:     &Config{Path: "test.conf", Track: StableTrack},
+			args:    Arguments{AllowPrerelease: true},
+			wantErr: "installing prereleases from the unstable track is not allowed by test.conf",
+		},
+		{
+			name:    "track-switch-disallowed",
+			cfg:     &strict,
+			args:    Arguments{Track: StableTrack},
+			wantErr: "switching to the stable track is not allowed by test.conf",
+		},
+		{
+			name: "pinned-version",
+			cfg:  &pinned,
+			want: Arguments{Version: "1.54.2", PinnedBy: "test.conf", PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name: "version-flag-wins-over-pin",
+			cfg:  &pinned,
+			args: Arguments{Version: "1.56.4"},
+			want: Arguments{Version: "1.56.4", PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name: "latest-keyword-wins-over-pin",
+			cfg:  &pinned,
+			args: Arguments{Version: "latest"},
+			want: Arguments{Track: StableTrack, PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name:    "track-keyword-switch-disallowed",
+			cfg:     &strict,
+			args:    Arguments{Version: "stable"},
+			wantErr: "switching to the stable track is not allowed by test.conf",
+		},
+		{
+			name: "track-flag-wins-over-pin",
+			cfg:  &pinned,
+			args: Arguments{Track: UnstableTrack},
+			want: Arguments{Track: UnstableTrack, PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name: "rollback-ignores-pin",
+			cfg:  &pinned,
+			args: Arguments{Rollback: true},
+			want: Arguments{Rollback: true, PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name: "reinstall-ignores-pin",
+			cfg:  &pinned,
+			args: Arguments{Reinstall: true},
+			want: Arguments{Reinstall: true, PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name: "local-file-ignores-pin",
+			cfg:  &pinned,
+			args: Arguments{LocalFile: "tailscale.tgz"},
+			want: Arguments{LocalFile: "tailscale.tgz", PkgsAddr: "https://mirror.example.com"},
+		},
+		{
+			name:    "pinned-downgrade-disallowed",
+			cfg:     &Config{Path: "test.conf", Version: "1.54.2"},
+			wantErr: "downgrading from 1.56.0 to 1.54.2 is not allowed by test.conf",
+		},
+		{
+			name: "same-track-allowed",
+			cfg:  &strict,
+			args: Arguments{Track: UnstableTrack},
+			want: Arguments{Track: UnstableTrack, PkgsAddr: "https://mirror.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.apply(tt.args, "1.56.0")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
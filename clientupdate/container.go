@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"tailscale.com/envknob"
+)
+
+// ignoreContainer makes ContainerReason report that this isn't a container,
+// for images that are deliberately updated in place.
+var ignoreContainer = envknob.RegisterBool("TS_UPDATE_IGNORE_CONTAINER")
+
+// ContainerReason reports why this process appears to be running inside a
+// container, such as "/.dockerenv exists", or "" if it doesn't appear to be.
+// Updating packages inside a container is usually a mistake: the update is
+// lost when the container is recreated from its image.
+//
+// It always returns "" if $TS_UPDATE_IGNORE_CONTAINER is set.
+func ContainerReason() string {
+	if runtime.GOOS != "linux" || ignoreContainer() {
+		return ""
+	}
+	return containerReason("/", os.Getenv)
+}
+
+// containerbootEnvs are environment variables that configure containerboot,
+// the entrypoint of the tailscale/tailscale image, which a "tailscale"
+// command run with "docker exec" inherits. Ones that tailscale or tailscaled
+// also use outside of containers, like $TS_AUTHKEY, are left out.
+var containerbootEnvs = []string{
+	"TS_KUBE_SECRET",
+	"TS_STATE_DIR",
+	"TS_USERSPACE",
+	"TS_AUTH_ONCE",
+	"TS_EXTRA_ARGS",
+	"TS_TAILSCALED_EXTRA_ARGS",
+	"TS_DEST_IP",
+	"TS_ROUTES",
+}
+
+// containerReason is ContainerReason with the filesystem root and environment
+// lookup function as parameters, for tests.
+func containerReason(root string, getenv func(string) string) string {
+	for _, name := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			return name + " exists"
+		}
+	}
+	// Set by podman, systemd-nspawn and LXC, among others.
+	if v := getenv("container"); v != "" {
+		return fmt.Sprintf("$container is %q", v)
+	}
+	if getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "$KUBERNETES_SERVICE_HOST is set"
+	}
+	for _, k := range containerbootEnvs {
+		if getenv(k) != "" {
+			return "$" + k + " is set"
+		}
+	}
+	cgroup, err := os.ReadFile(filepath.Join(root, "proc/1/cgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, s := range []string{"/docker/", "/kubepods", "/lxc/", "/containerd/"} {
+		if strings.Contains(string(cgroup), s) {
+			return fmt.Sprintf("/proc/1/cgroup contains %q", s)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainerReason(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		env   map[string]string
+		want  string
+	}{
+		{name: "host", files: map[string]string{"proc/1/cgroup": "0::/init.scope\n"}},
+		{name: "no-proc"},
+		{name: "docker", files: map[string]string{".dockerenv": ""}, want: "/.dockerenv exists"},
+		{name: "podman", files: map[string]string{"run/.containerenv": ""}, want: "/run/.containerenv exists"},
+		{name: "nspawn", env: map[string]string{"container": "systemd-nspawn"}, want: `$container is "systemd-nspawn"`},
+		{name: "kubernetes", env: map[string]string{"KUBERNETES_SERVICE_HOST": "10.0.0.1"}, want: "$KUBERNETES_SERVICE_HOST is set"},
+		{name: "containerboot", env: map[string]string{"TS_USERSPACE": "false"}, want: "$TS_USERSPACE is set"},
+		{name: "containerboot-kube", env: map[string]string{"TS_KUBE_SECRET": "tailscale"}, want: "$TS_KUBE_SECRET is set"},
+		{name: "authkey-only", env: map[string]string{"TS_AUTHKEY": "tskey-auth-x"}},
+		{
+			name:  "docker-cgroup",
+			files: map[string]string{"proc/1/cgroup": "12:pids:/docker/0123abcd\n"},
+			want:  `/proc/1/cgroup contains "/docker/"`,
+		},
+		{
+			name:  "lxc-cgroup",
+			files: map[string]string{"proc/1/cgroup": "0::/lxc/ct1\n"},
+			want:  `/proc/1/cgroup contains "/lxc/"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, contents := range tt.files {
+				p := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			getenv := func(k string) string { return tt.env[k] }
+			if got := containerReason(root, getenv); got != tt.want {
+				t.Errorf("containerReason = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -38,9 +38,11 @@
 package distsign
 
 import (
+	"cmp"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/pem"
 	"errors"
@@ -48,13 +50,22 @@
 	"hash"
 	"io"
 	"log"
+	mrand "math/rand/v2"
+	"mime"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hdevalence/ed25519consensus"
 	"golang.org/x/crypto/blake2s"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/time/rate"
 	"tailscale.com/net/tshttpproxy"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/httpm"
@@ -68,6 +79,8 @@
 	pemTypeSigningPublic  = "SIGNING PUBLIC KEY"
 
 	downloadSizeLimit    = 1 << 29 // 512MB
+	defaultMaxAttempts   = 4
+	defaultSegments      = 1
 	signingKeysSizeLimit = 1 << 20 // 1MB
 	signatureSizeLimit   = ed25519.SignatureSize
 )
@@ -184,9 +197,23 @@ func (ph *PackageHash) Len() int64 { return ph.len }
 
 // Client downloads and validates files from a distribution server.
 type Client struct {
-	logf     logger.Logf
-	roots    []ed25519.PublicKey
-	pkgsAddr *url.URL
+	logf        logger.Logf
+	roots       []ed25519.PublicKey
+	pkgsAddr    *url.URL
+	maxAttempts int   // 0 means defaultMaxAttempts
+	maxRate     int64 // in bytes per second; 0 means unlimited
+	segments    int   // parallel range requests per download; 0 means defaultSegments
+
+	quietProgress bool        // only log progress at the end of a download
+	tlsConfig     *tls.Config // nil means the default TLS settings
+	proxy         *url.URL    // nil means the proxy from the environment
+	sourceAddr    netip.Addr  // zero means any local address
+	contentTypes  []string    // accepted download media types; nil means any
+	redirectLogf  logger.Logf // logs redirects and final URLs; nil means none
+
+	spaceCheck func(dst string, size int64) error // nil means no check
+
+	progressFunc func(done, total int64) // nil means none
 }
 
 // NewClient returns a new client for distribution server located at pkgsAddr,
@@ -202,6 +229,239 @@ func NewClient(logf logger.Logf, pkgsAddr string) (*Client, error) {
 	return &Client{logf: logf, roots: roots(), pkgsAddr: u}, nil
 }
 
+// SetMaxAttempts sets the maximum number of attempts made for each download
+// before giving up. Values less than 1 restore the default of 4 attempts.
+func (c *Client) SetMaxAttempts(n int) {
+	c.maxAttempts = n
+}
+
+// SetSegments sets the number of parts that large downloads are split into
+// and fetched in parallel, for servers that support range requests. Values
+// less than 1 restore the default of 1, which disables splitting. A partial
+// file left by an earlier attempt is always resumed with a single request
+// instead of being split.
+func (c *Client) SetSegments(n int) {
+	c.segments = n
+}
+
+// SetContentTypes sets the media types that downloads are expected to be
+// served as, like "application/x-msi". Downloads served as anything else fail
+// before they start, to catch captive portals and misconfigured mirrors that
+// return an HTML page instead of the package. Responses without a
+// Content-Type, or with application/octet-stream, are always accepted. An
+// empty list, the default, accepts any type.
+func (c *Client) SetContentTypes(types []string) {
+	c.contentTypes = types
+}
+
+// checkContentType returns an error if res is not one of c's expected content
+// types.
+func (c *Client) checkContentType(res *http.Response) error {
+	if len(c.contentTypes) == 0 {
+		return nil
+	}
+	ct := res.Header.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err == nil && (mt == "application/octet-stream" || slices.Contains(c.contentTypes, mt)) {
+		return nil
+	}
+	return contentTypeError{res.Request.Method, res.Request.URL.String(), c.contentTypes, ct}
+}
+
+// contentTypeError is returned when a server responds with an unexpected
+// Content-Type. It's not worth retrying.
+type contentTypeError struct {
+	method string
+	url    string
+	want   []string
+	got    string
+}
+
+func (e contentTypeError) Error() string {
+	return fmt.Sprintf("%s %q: expected a binary package (%s) but got %s", e.method, e.url, strings.Join(e.want, " or "), e.got)
+}
+
+// SetMaxRate limits the speed of package downloads to bytesPerSec. Values less
+// than 1 remove the limit.
+func (c *Client) SetMaxRate(bytesPerSec int64) {
+	c.maxRate = bytesPerSec
+}
+
+// SetQuietProgress controls whether download progress is logged every few
+// seconds (the default) or only once a download completes, for output that is
+// not going to a terminal.
+func (c *Client) SetQuietProgress(quiet bool) {
+	c.quietProgress = quiet
+}
+
+// SetSpaceCheck sets a function that is called before each download starts,
+// with the destination path and the number of bytes still to be written to
+// it, to fail early when there is not enough disk space for the download. The
+// download fails without being retried if check returns an error. A nil
+// check, the default, disables the check.
+func (c *Client) SetSpaceCheck(check func(dst string, size int64) error) {
+	c.spaceCheck = check
+}
+
+// SetProgressFunc sets a function that is called with the number of bytes
+// downloaded so far and the total size, or 0 if it's unknown, as downloads
+// progress, such as to draw a progress bar. It's called at most every
+// progressFuncInterval and once more when a download completes, never
+// concurrently, and must not block. It's called in addition to progress being
+// logged, which SetQuietProgress controls. A nil fn, the default, disables it.
+func (c *Client) SetProgressFunc(fn func(done, total int64)) {
+	c.progressFunc = fn
+}
+
+// progressFuncInterval is the minimum interval between calls to a Client's
+// progress func during a download.
+const progressFuncInterval = 250 * time.Millisecond
+
+// spaceCheckError is returned when a Client's space check fails. It's not
+// worth retrying.
+type spaceCheckError struct {
+	err error
+}
+
+func (e spaceCheckError) Error() string { return e.err.Error() }
+func (e spaceCheckError) Unwrap() error { return e.err }
+
+// SetTLSConfig sets the TLS configuration used for connections to the
+// distribution server, for example to trust an additional CA or to present a
+// client certificate to a private mirror. A nil config restores the default.
+func (c *Client) SetTLSConfig(conf *tls.Config) {
+	c.tlsConfig = conf
+}
+
+// SetProxy sets the proxy used for connections to the distribution server,
+// instead of the one from the environment. A nil URL restores the default.
+// See ProxyFunc.
+func (c *Client) SetProxy(proxy *url.URL) {
+	c.proxy = proxy
+}
+
+// ProxyFunc returns an http.Transport Proxy func for connections to the
+// distribution server. It uses proxy if it's non-nil, which may be a socks5
+// or socks5h URL with a username and password. Otherwise, it uses the proxy
+// from the environment that tshttpproxy.ProxyFromEnvironment finds, or else a
+// SOCKS5 proxy from $ALL_PROXY, which net/http doesn't look at.
+func ProxyFunc(proxy *url.URL) func(*http.Request) (*url.URL, error) {
+	if proxy != nil {
+		return http.ProxyURL(proxy)
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := tshttpproxy.ProxyFromEnvironment(req)
+		if u != nil || err != nil {
+			return u, err
+		}
+		return allProxyFromEnvironment(req.URL)
+	}
+}
+
+// allProxyFromEnvironment returns the proxy to use for reqURL from $ALL_PROXY
+// (or $all_proxy), like curl does, honoring $NO_PROXY. Only socks5 and
+// socks5h proxies are used from it, as other schemes are already covered by
+// $HTTP_PROXY and $HTTPS_PROXY; it returns nil for the others or if it's not
+// set.
+func allProxyFromEnvironment(reqURL *url.URL) (*url.URL, error) {
+	all := cmp.Or(os.Getenv("ALL_PROXY"), os.Getenv("all_proxy"))
+	if all == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(all); err != nil || (u.Scheme != "socks5" && u.Scheme != "socks5h") {
+		return nil, nil
+	}
+	conf := &httpproxy.Config{
+		HTTPProxy:  all,
+		HTTPSProxy: all,
+		NoProxy:    cmp.Or(os.Getenv("NO_PROXY"), os.Getenv("no_proxy")),
+	}
+	return conf.ProxyFunc()(reqURL)
+}
+
+// SetSourceAddr sets the local address that connections to the distribution
+// server are made from, to pick the interface they go out of on a multi-homed
+// machine. The zero Addr, the default, lets the system choose.
+func (c *Client) SetSourceAddr(addr netip.Addr) {
+	c.sourceAddr = addr
+}
+
+// SourceDialer returns a dialer with the settings of http.DefaultTransport's
+// that makes connections from the local address src.
+func SourceDialer(src netip.Addr) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		LocalAddr: &net.TCPAddr{IP: src.AsSlice(), Zone: src.Zone()},
+	}
+}
+
+// SourceDialContext returns an http.Transport DialContext func that makes
+// connections from the local address src with SourceDialer, and that says so
+// when they fail, as failures to bind to src are otherwise hard to tell from
+// other connection errors.
+func SourceDialContext(src netip.Addr) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := SourceDialer(src)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to %s from source address %v: %w", addr, src, err)
+		}
+		return conn, nil
+	}
+}
+
+// SetRedirectLogf sets a logger for each HTTP redirect followed and for the
+// final URL that each download is served from, for debugging mirror and CDN
+// setups. A nil logger, the default, doesn't log them.
+func (c *Client) SetRedirectLogf(logf logger.Logf) {
+	c.redirectLogf = logf
+}
+
+// CheckRedirect returns an http.Client CheckRedirect func for requests to the
+// distribution server. Like the default, it stops after 10 redirects. It also
+// refuses redirects from https to http, which would expose the rest of the
+// request to anyone on the network path. If logf is non-nil, each redirect
+// followed is logged with it.
+func CheckRedirect(logf logger.Logf) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		prev := via[len(via)-1].URL
+		if prev.Scheme == "https" && req.URL.Scheme != "https" {
+			return fmt.Errorf("refusing redirect from %s to non-https %s", prev, req.URL)
+		}
+		if logf != nil {
+			logf("redirected from %s to %s", prev, req.URL)
+		}
+		return nil
+	}
+}
+
+// newHTTPClient returns an HTTP client for requests to the distribution
+// server over tr.
+func (c *Client) newHTTPClient(tr *http.Transport) *http.Client {
+	return &http.Client{Transport: tr, CheckRedirect: CheckRedirect(c.redirectLogf)}
+}
+
+// newTransport returns a new HTTP transport for requests to the distribution
+// server. Callers should close its idle connections when done with it.
+func (c *Client) newTransport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = ProxyFunc(c.proxy)
+	if c.tlsConfig != nil {
+		tr.TLSClientConfig = c.tlsConfig.Clone()
+	}
+	if c.sourceAddr.IsValid() {
+		tr.DialContext = SourceDialContext(c.sourceAddr)
+	}
+	return tr
+}
+
 func (c *Client) url(path string) string {
 	return c.pkgsAddr.JoinPath(path).String()
 }
@@ -210,6 +470,10 @@ func (c *Client) url(path string) string {
 // The file is downloaded to dstPath and its signature is validated using the
 // embedded root keys. Download returns an error if anything goes wrong with
 // the actual file download or with signature validation.
+//
+// The signature is fetched before the file, and kept next to the partial
+// download until it completes, so that a download resumed after a failure can
+// be validated even if the signature can't be fetched again.
 func (c *Client) Download(ctx context.Context, srcPath, dstPath string) error {
 	// Always fetch a fresh signing key.
 	sigPub, err := c.signingKeys()
@@ -220,20 +484,49 @@ func (c *Client) Download(ctx context.Context, srcPath, dstPath string) error {
 	srcURL := c.url(srcPath)
 	sigURL := srcURL + ".sig"
 
-	c.logf("Downloading %q", srcURL)
 	dstPathUnverified := dstPath + ".unverified"
-	hash, len, err := c.download(ctx, srcURL, dstPathUnverified, downloadSizeLimit)
+	sigCachePath := dstPathUnverified + ".sig"
+	c.logf("Downloading %q", sigURL)
+	sig, err := c.fetchSignature(ctx, sigURL, sigCachePath)
 	if err != nil {
 		return err
 	}
-	c.logf("Downloading %q", sigURL)
-	sig, err := fetch(sigURL, signatureSizeLimit)
-	if err != nil {
-		// Best-effort clean up of downloaded package.
-		os.Remove(dstPathUnverified)
+
+	c.logf("Downloading %q", srcURL)
+	var hash []byte
+	var len int64
+	var resumed bool
+	downloadWithRetries := func() error {
+		return c.retry(ctx, func() error {
+			// Retries resume from the partial file left by a failed attempt.
+			var err error
+			hash, len, resumed, err = c.download(ctx, srcURL, dstPathUnverified, downloadSizeLimit)
+			return err
+		})
+	}
+	if err := downloadWithRetries(); err != nil {
+		// Keep the partial file for a later attempt to resume from, unless
+		// the failure would only happen again.
+		if !isRetryable(err) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			// Best-effort clean up of downloaded package.
+			removePartialDownload(dstPathUnverified)
+		}
 		return err
 	}
 	msg := binary.LittleEndian.AppendUint64(hash, uint64(len))
+	if resumed && !VerifyAny(sigPub, msg, sig) {
+		// The part downloaded by an earlier attempt may be of another file
+		// than the rest, if the server had no validator for If-Range to
+		// catch it being replaced in between.
+		c.logf("Resumed download of %q does not validate; downloading it again from the start", srcURL)
+		removePartialDownload(dstPathUnverified)
+		if err := downloadWithRetries(); err != nil {
+			return err
+		}
+		msg = binary.LittleEndian.AppendUint64(hash, uint64(len))
+	}
+	// The signature is no longer needed for resuming.
+	os.Remove(sigCachePath)
 	if !VerifyAny(sigPub, msg, sig) {
 		// Best-effort clean up of downloaded package.
 		os.Remove(dstPathUnverified)
@@ -276,7 +569,7 @@ func (c *Client) ValidateLocalBinary(srcURLPath, localFilePath string) error {
 	hash, hashLen := h.Sum(nil), h.Len()
 
 	c.logf("Downloading %q", sigURL)
-	sig, err := fetch(sigURL, signatureSizeLimit)
+	sig, err := c.fetch(context.Background(), sigURL, signatureSizeLimit)
 	if err != nil {
 		return err
 	}
@@ -290,17 +583,51 @@ func (c *Client) ValidateLocalBinary(srcURLPath, localFilePath string) error {
 	return nil
 }
 
+// ResolveURL sends a HEAD request for the file at path srcPath on pkgsAddr
+// passed in NewClient, following any HTTP redirects. It returns every URL
+// visited, starting with the URL constructed from srcPath and ending with the
+// effective URL the file is served from, along with the size of the file.
+func (c *Client) ResolveURL(ctx context.Context, srcPath string) (chain []string, size int64, err error) {
+	tr := c.newTransport()
+	defer tr.CloseIdleConnections()
+
+	srcURL := c.url(srcPath)
+	chain = []string{srcURL}
+	hc := c.newHTTPClient(tr)
+	checkRedirect := hc.CheckRedirect
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := checkRedirect(req, via); err != nil {
+			return err
+		}
+		chain = append(chain, req.URL.String())
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req := must.Get(http.NewRequestWithContext(ctx, httpm.HEAD, srcURL, nil))
+	res, err := hc.Do(req)
+	if err != nil {
+		return chain, 0, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return chain, 0, fmt.Errorf("HEAD %q: %v", chain[len(chain)-1], res.Status)
+	}
+	return chain, res.ContentLength, nil
+}
+
 // signingKeys fetches current signing keys from the server and validates them
 // against the roots. Should be called before validation of any downloaded file
 // to get the fresh keys.
 func (c *Client) signingKeys() ([]ed25519.PublicKey, error) {
 	keyURL := c.url("distsign.pub")
 	sigURL := keyURL + ".sig"
-	raw, err := fetch(keyURL, signingKeysSizeLimit)
+	raw, err := c.fetch(context.Background(), keyURL, signingKeysSizeLimit)
 	if err != nil {
 		return nil, err
 	}
-	sig, err := fetch(sigURL, signatureSizeLimit)
+	sig, err := c.fetch(context.Background(), sigURL, signatureSizeLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -315,24 +642,124 @@ func (c *Client) signingKeys() ([]ed25519.PublicKey, error) {
 	return keys, nil
 }
 
+// fetchSignature fetches the signature at sigURL and caches it at cachePath,
+// next to the partial download that it's for. If the signature can't be
+// fetched, as when the server is briefly unavailable while a download that
+// failed earlier is resumed, the one cached by the earlier attempt is used
+// instead. The cache does not need to be trusted, as the signature is
+// verified like a fetched one.
+func (c *Client) fetchSignature(ctx context.Context, sigURL, cachePath string) ([]byte, error) {
+	sig, err := c.fetch(ctx, sigURL, signatureSizeLimit)
+	if err != nil {
+		cached, cerr := os.ReadFile(cachePath)
+		if cerr != nil {
+			return nil, err
+		}
+		c.logf("Failed to download %q: %v; using the signature cached by an earlier attempt", sigURL, err)
+		return cached, nil
+	}
+	if err := os.WriteFile(cachePath, sig, 0644); err != nil {
+		// Only resuming without access to the signature needs the cache.
+		c.logf("Failed to cache the signature: %v", err)
+	}
+	return sig, nil
+}
+
+// fetch is like the fetch function, but retries transient failures.
+func (c *Client) fetch(ctx context.Context, url string, limit int64) (b []byte, err error) {
+	tr := c.newTransport()
+	defer tr.CloseIdleConnections()
+	hc := c.newHTTPClient(tr)
+	err = c.retry(ctx, func() error {
+		b, err = fetch(hc, url, limit)
+		return err
+	})
+	return b, err
+}
+
 // fetch reads the response body from url into memory, up to limit bytes.
-func fetch(url string, limit int64) ([]byte, error) {
-	resp, err := http.Get(url)
+func fetch(hc *http.Client, url string, limit int64) ([]byte, error) {
+	resp, err := hc.Get(url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError{httpm.GET, url, resp}
+	}
 
 	return io.ReadAll(io.LimitReader(resp.Body, limit))
 }
 
+// statusError is returned when a server responds with an unexpected HTTP
+// status code.
+type statusError struct {
+	method string
+	url    string
+	res    *http.Response
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%s %q: %v", e.method, e.url, e.res.Status)
+}
+
+// retryBaseDelay is the delay before the first retry of a failed request. It
+// doubles after each attempt. Var allows overriding this in tests.
+var retryBaseDelay = time.Second
+
+// retry calls f until it succeeds, returns an error that is not worth
+// retrying, or c's maximum number of attempts is reached. Connection errors
+// and 5xx responses are retried with exponential backoff and jitter; 4xx
+// responses are not.
+func (c *Client) retry(ctx context.Context, f func() error) error {
+	attempts := c.maxAttempts
+	if attempts < 1 {
+		attempts = defaultMaxAttempts
+	}
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= attempts || !isRetryable(err) {
+			return err
+		}
+		wait := delay/2 + mrand.N(delay) // 0.5x to 1.5x of delay
+		c.logf("Attempt %d/%d failed: %v; retrying in %v", attempt, attempts, err, wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se statusError
+	if errors.As(err, &se) {
+		return se.res.StatusCode >= 500
+	}
+	var cte contentTypeError
+	if errors.As(err, &cte) {
+		return false
+	}
+	var sce spaceCheckError
+	if errors.As(err, &sce) {
+		return false
+	}
+	return true
+}
+
 // download writes the response body of url into a local file at dst, up to
 // limit bytes. On success, the returned value is a BLAKE2s hash of the file.
-func (c *Client) download(ctx context.Context, url, dst string, limit int64) ([]byte, int64, error) {
-	tr := http.DefaultTransport.(*http.Transport).Clone()
-	tr.Proxy = tshttpproxy.ProxyFromEnvironment
+// resumed reports whether the download continued a partial file left at dst by
+// an earlier attempt.
+func (c *Client) download(ctx context.Context, url, dst string, limit int64) (hash []byte, n int64, resumed bool, err error) {
+	tr := c.newTransport()
 	defer tr.CloseIdleConnections()
-	hc := &http.Client{Transport: tr}
+	hc := c.newHTTPClient(tr)
 
 	quickCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -340,70 +767,441 @@ func (c *Client) download(ctx context.Context, url, dst string, limit int64) ([]
 
 	res, err := hc.Do(headReq)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, false, err
 	}
 	if res.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("HEAD %q: %v", url, res.Status)
+		return nil, 0, false, statusError{httpm.HEAD, url, res}
 	}
 	if res.ContentLength <= 0 {
-		return nil, 0, fmt.Errorf("HEAD %q: unexpected Content-Length %v", url, res.ContentLength)
+		return nil, 0, false, fmt.Errorf("HEAD %q: unexpected Content-Length %v", url, res.ContentLength)
+	}
+	if err := c.checkContentType(res); err != nil {
+		return nil, 0, false, err
+	}
+	if c.redirectLogf != nil {
+		c.redirectLogf("%s is served from %s", url, res.Request.URL)
 	}
 	c.logf("Download size: %v", res.ContentLength)
+	if c.spaceCheck != nil {
+		// Both resumed and segmented downloads reuse the space of a partial
+		// file left by an earlier attempt.
+		need := res.ContentLength
+		if fi, err := os.Stat(dst); err == nil && fi.Mode().IsRegular() && fi.Size() < need {
+			need -= fi.Size()
+		}
+		if err := c.spaceCheck(dst, need); err != nil {
+			return nil, 0, false, spaceCheckError{err}
+		}
+	}
+
+	// Resume from a partial file left on disk by an earlier attempt, if any.
+	var have int64
+	if fi, err := os.Stat(dst); err == nil && fi.Mode().IsRegular() && fi.Size() < res.ContentLength {
+		have = fi.Size()
+	}
+	validatorPath := dst + ".validator"
+
+	if n := c.numSegments(res); n > 1 && have == 0 {
+		if res.ContentLength > limit {
+			return nil, 0, false, fmt.Errorf("HEAD %q: Content-Length %v exceeds the limit of %v", url, res.ContentLength, limit)
+		}
+		os.Remove(validatorPath)
+		hash, n, err := c.downloadSegments(ctx, hc, url, dst, res.ContentLength, n)
+		return hash, n, false, err
+	}
 
 	dlReq := must.Get(http.NewRequestWithContext(ctx, httpm.GET, url, nil))
+	if have > 0 {
+		dlReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", have))
+		// Only get the rest of the file if it's still the one that the
+		// partial file is the start of; otherwise the server sends all of
+		// the new one.
+		if v, err := os.ReadFile(validatorPath); err == nil && len(v) > 0 {
+			dlReq.Header.Set("If-Range", string(v))
+		}
+	}
 	dlRes, err := hc.Do(dlReq)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, false, err
 	}
 	defer dlRes.Body.Close()
-	// TODO(bradfitz): resume from existing partial file on disk
-	if dlRes.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("GET %q: %v", url, dlRes.Status)
+	// The GET can be answered differently from the HEAD, as by a captive
+	// portal or a mirror that only handles HEAD requests itself.
+	if dlRes.StatusCode == http.StatusOK || dlRes.StatusCode == http.StatusPartialContent {
+		if err := c.checkContentType(dlRes); err != nil {
+			return nil, 0, false, err
+		}
 	}
 
-	of, err := os.Create(dst)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer of.Close()
-	pw := &progressWriter{total: res.ContentLength, logf: c.logf}
 	h := NewPackageHash()
-	n, err := io.Copy(io.MultiWriter(of, h, pw), io.LimitReader(dlRes.Body, limit))
+	var of *os.File
+	switch {
+	case have > 0 && dlRes.StatusCode == http.StatusPartialContent:
+		if err := checkContentRange(dlRes, have, res.ContentLength); err != nil {
+			// Start over on the next attempt rather than append the wrong
+			// bytes to the partial file.
+			removePartialDownload(dst)
+			return nil, 0, false, fmt.Errorf("GET %q: %w", url, err)
+		}
+		c.logf("Resuming download at %v/%v", have, res.ContentLength)
+		resumed = true
+		of, err = os.OpenFile(dst, os.O_RDWR, 0)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		defer of.Close()
+		// Seed the hash with the bytes we already have.
+		if _, err := io.CopyN(h, of, have); err != nil {
+			return nil, 0, false, err
+		}
+	case dlRes.StatusCode == http.StatusOK:
+		// Either there was nothing to resume, the file changed since the
+		// partial download, or the server does not support range
+		// requests; start over.
+		have = 0
+		of, err = os.Create(dst)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		defer of.Close()
+		// Remember which version of the file this is, for resuming it.
+		if v := rangeValidator(dlRes); v != "" {
+			if err := os.WriteFile(validatorPath, []byte(v), 0644); err != nil {
+				c.logf("Failed to save the download's validator: %v", err)
+			}
+		} else {
+			os.Remove(validatorPath)
+		}
+	default:
+		return nil, 0, false, statusError{httpm.GET, url, dlRes}
+	}
+
+	var body io.Reader = io.LimitReader(dlRes.Body, limit-have)
+	if c.maxRate > 0 {
+		body = newRateLimitedReader(ctx, body, c.maxRate)
+	}
+	pw := newProgressWriter(have, res.ContentLength, c.logf)
+	pw.quiet = c.quietProgress
+	pw.onProgress = c.progressFunc
+	n, err = io.Copy(io.MultiWriter(of, h, pw), body)
+	n += have
 	if err != nil {
-		return nil, n, err
+		return nil, n, resumed, err
 	}
 	if n != res.ContentLength {
-		return nil, n, fmt.Errorf("GET %q: downloaded %v, want %v", url, n, res.ContentLength)
+		return nil, n, resumed, fmt.Errorf("GET %q: downloaded %v, want %v", url, n, res.ContentLength)
 	}
 	if err := dlRes.Body.Close(); err != nil {
-		return nil, n, err
+		return nil, n, resumed, err
 	}
 	if err := of.Close(); err != nil {
-		return nil, n, err
+		return nil, n, resumed, err
+	}
+	pw.print()
+	os.Remove(validatorPath)
+
+	return h.Sum(nil), h.Len(), resumed, nil
+}
+
+// rangeValidator returns the value for an If-Range header that resumes the
+// download of the file that res is for only if it's unchanged: its ETag, if
+// it's a strong one, or else its Last-Modified time. It returns "" if res has
+// neither.
+func rangeValidator(res *http.Response) string {
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return res.Header.Get("Last-Modified")
+}
+
+// checkContentRange checks that the Content-Range of res, a 206 response to a
+// request for the rest of a size-byte file from offset have, is that range.
+func checkContentRange(res *http.Response, have, size int64) error {
+	cr := res.Header.Get("Content-Range")
+	var start, end, total int64
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &total); err != nil || start != have || end != size-1 || total != size {
+		return fmt.Errorf("got Content-Range %q, want bytes %d-%d/%d", cr, have, size-1, size)
+	}
+	return nil
+}
+
+// removePartialDownload removes the partial download at dst, along with the
+// validator saved for resuming it, so that the next attempt starts over.
+func removePartialDownload(dst string) {
+	os.Remove(dst)
+	os.Remove(dst + ".validator")
+}
+
+// minSegmentSize is the smallest part that a download is split into, so that
+// small files are fetched with a single request. Var allows overriding this in
+// tests.
+var minSegmentSize int64 = 4 << 20
+
+// numSegments returns the number of parallel range requests to split a
+// download into, given the response to a HEAD request for it. It returns 1 if
+// the server doesn't support range requests or the file is too small to be
+// worth splitting.
+func (c *Client) numSegments(head *http.Response) int {
+	n := c.segments
+	if n < 1 {
+		n = defaultSegments
+	}
+	if head.Header.Get("Accept-Ranges") != "bytes" {
+		return 1
+	}
+	return int(max(1, min(int64(n), head.ContentLength/minSegmentSize)))
+}
+
+// downloadSegments is like download, but splits the size bytes at url into n
+// parts that are requested in parallel and written into dst at their offsets.
+// It does not resume partial files.
+func (c *Client) downloadSegments(ctx context.Context, hc *http.Client, url, dst string, size int64, n int) ([]byte, int64, error) {
+	c.logf("Downloading in %d segments", n)
+	of, err := os.Create(dst)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer of.Close()
+	// Allocate the whole file up front, so that a failed attempt leaves a
+	// file that's not mistaken for a partial download and resumed.
+	if err := of.Truncate(size); err != nil {
+		return nil, 0, err
+	}
+
+	var lim *rate.Limiter
+	if c.maxRate > 0 {
+		lim = newRateLimiter(c.maxRate)
+	}
+	pw := newProgressWriter(0, size, c.logf)
+	pw.quiet = c.quietProgress
+	pw.onProgress = c.progressFunc
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, n)
+	segSize := size / int64(n)
+	for i := range n {
+		start := int64(i) * segSize
+		end := start + segSize // exclusive
+		if i == n-1 {
+			end = size
+		}
+		go func() {
+			err := c.downloadSegment(ctx, hc, url, of, start, end, lim, pw)
+			if err != nil {
+				cancel()
+			}
+			errc <- err
+		}()
+	}
+	var firstErr error
+	for range n {
+		if err := <-errc; err != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, pw.Done(), firstErr
 	}
 	pw.print()
 
+	if _, err := of.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	h := NewPackageHash()
+	if _, err := io.Copy(h, of); err != nil {
+		return nil, 0, err
+	}
+	if err := of.Close(); err != nil {
+		return nil, 0, err
+	}
 	return h.Sum(nil), h.Len(), nil
 }
 
+// downloadSegment fetches bytes [start, end) of url into the same offsets of
+// of, reporting progress to pw and limiting its speed with lim, if non-nil.
+func (c *Client) downloadSegment(ctx context.Context, hc *http.Client, url string, of *os.File, start, end int64, lim *rate.Limiter, pw *progressWriter) error {
+	req := must.Get(http.NewRequestWithContext(ctx, httpm.GET, url, nil))
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		return statusError{httpm.GET, url, res}
+	}
+	if err := c.checkContentType(res); err != nil {
+		return err
+	}
+	var body io.Reader = io.LimitReader(res.Body, end-start)
+	if lim != nil {
+		body = &rateLimitedReader{ctx: ctx, r: body, lim: lim}
+	}
+	n, err := io.Copy(io.MultiWriter(io.NewOffsetWriter(of, start), pw), body)
+	if err != nil {
+		return err
+	}
+	if n != end-start {
+		return fmt.Errorf("GET %q bytes %d-%d: downloaded %v, want %v", url, start, end-1, n, end-start)
+	}
+	return nil
+}
+
+// rateLimitedReader is an io.Reader that reads from r at no more than a
+// limited number of bytes per second.
+type rateLimitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	lim *rate.Limiter
+}
+
+func newRateLimitedReader(ctx context.Context, r io.Reader, bytesPerSec int64) *rateLimitedReader {
+	return &rateLimitedReader{ctx: ctx, r: r, lim: newRateLimiter(bytesPerSec)}
+}
+
+// newRateLimiter returns a limiter for reads of bytesPerSec, which may be
+// shared by several rateLimitedReaders to limit their combined speed.
+func newRateLimiter(bytesPerSec int64) *rate.Limiter {
+	// Allow reads in chunks of up to 32KB, the io.Copy buffer size, but no
+	// more than a second's worth of data.
+	burst := int(min(bytesPerSec, 32<<10))
+	lim := rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+	// Start with an empty bucket, so that the very first chunk is limited
+	// too.
+	lim.AllowN(time.Now(), burst)
+	return lim
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.lim.Burst() {
+		p = p[:r.lim.Burst()]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.lim.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// progressWriter logs the progress of a download as it's written to. It's
+// safe for concurrent use, like by the segments of a download writing to it
+// through their own io.MultiWriters, and its progress lines are never
+// interleaved.
 type progressWriter struct {
+	mu        sync.Mutex // guards the fields below
 	done      int64
-	total     int64
+	total     int64 // 0 if unknown
 	lastPrint time.Time
 	logf      logger.Logf
+	quiet     bool // don't print until the download completes
+
+	onProgress   func(done, total int64) // nil means none
+	lastProgress time.Time               // when onProgress was last called
+
+	start     time.Time // when the download started
+	lastDone  int64     // done at lastPrint
+	rate      float64   // rolling average in bytes per second
+	startDone int64     // done at start, for a resumed download
+}
+
+func newProgressWriter(done, total int64, logf logger.Logf) *progressWriter {
+	now := time.Now()
+	return &progressWriter{
+		done:      done,
+		total:     total,
+		logf:      logf,
+		start:     now,
+		lastPrint: now,
+		lastDone:  done,
+		startDone: done,
+	}
 }
 
 func (pw *progressWriter) Write(p []byte) (n int, err error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
 	pw.done += int64(len(p))
-	if time.Since(pw.lastPrint) > 2*time.Second {
-		pw.print()
+	if !pw.quiet && time.Since(pw.lastPrint) > 2*time.Second {
+		pw.printLocked()
+	}
+	if pw.onProgress != nil && time.Since(pw.lastProgress) >= progressFuncInterval {
+		pw.lastProgress = time.Now()
+		pw.onProgress(pw.done, pw.total)
 	}
 	return len(p), nil
 }
 
+// Done returns the number of bytes downloaded so far, including those of a
+// resumed download from before it was resumed.
+func (pw *progressWriter) Done() int64 {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.done
+}
+
+// print logs the current progress, and reports it to the progress func, if
+// any.
 func (pw *progressWriter) print() {
-	pw.lastPrint = time.Now()
-	pw.logf("Downloaded %v/%v (%.1f%%)", pw.done, pw.total, float64(pw.done)/float64(pw.total)*100)
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.printLocked()
+	if pw.onProgress != nil {
+		pw.onProgress(pw.done, pw.total)
+	}
+}
+
+func (pw *progressWriter) printLocked() {
+	pw.logf("%s", pw.status(time.Now()))
+}
+
+// rateSmoothing is the weight of the latest measurement in the rolling
+// download rate, to keep the ETA from jumping around.
+const rateSmoothing = 0.3
+
+// status updates the download rate as of now and returns a progress line
+// with the rate and the estimated time remaining. pw.mu must be held.
+func (pw *progressWriter) status(now time.Time) string {
+	if elapsed := now.Sub(pw.lastPrint).Seconds(); elapsed > 0 {
+		cur := float64(pw.done-pw.lastDone) / elapsed
+		if pw.lastDone == pw.startDone {
+			pw.rate = cur
+		} else {
+			pw.rate = rateSmoothing*cur + (1-rateSmoothing)*pw.rate
+		}
+	}
+	pw.lastPrint = now
+	pw.lastDone = pw.done
+
+	if pw.total <= 0 {
+		return fmt.Sprintf("Downloaded %v, %s/s", pw.done, formatBytes(pw.rate))
+	}
+	line := fmt.Sprintf("Downloaded %v/%v (%.1f%%), %s/s", pw.done, pw.total, float64(pw.done)/float64(pw.total)*100, formatBytes(pw.rate))
+	switch {
+	case pw.done >= pw.total:
+		if d := now.Sub(pw.start); d > 0 {
+			line += fmt.Sprintf(", %s/s average over %v", formatBytes(float64(pw.done-pw.startDone)/d.Seconds()), d.Round(time.Second))
+		}
+	case pw.rate > 0:
+		eta := time.Duration(float64(pw.total-pw.done) / pw.rate * float64(time.Second))
+		line += fmt.Sprintf(", %v remaining", eta.Round(time.Second))
+	}
+	return line
+}
+
+// formatBytes formats n bytes with a decimal unit, like "1.5 MB".
+func formatBytes(n float64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1f GB", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", n/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1f kB", n/1e3)
+	}
+	return fmt.Sprintf("%.0f B", n)
 }
 
 func parsePrivateKey(data []byte, typeTag string) (ed25519.PrivateKey, error) {
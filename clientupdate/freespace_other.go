@@ -0,0 +1,18 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !linux && !windows
+
+package clientupdate
+
+import "errors"
+
+func freeSpace(path string) (uint64, error) {
+	// Only used on Linux and Windows.
+	return 0, errors.ErrUnsupported
+}
+
+func freeInodes(path string) (uint64, error) {
+	// Only used on Linux.
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,370 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultGitHubAPIAddr is the default GitHubVersionSource.APIAddr.
+	defaultGitHubAPIAddr = "https://api.github.com"
+	// defaultGitHubRepo is the default GitHubVersionSource.Repo.
+	defaultGitHubRepo = "tailscale/tailscale"
+)
+
+// GitHubVersionSource is a VersionSource that looks up releases with the
+// GitHub releases API, for machines that can reach github.com but not a pkgs
+// server. Only Windows MSIs and Linux tarballs are published as release
+// assets, so it fails for other platforms.
+//
+// The Releases it returns have URL set to the package's asset, and SHA256 set
+// from the checksums published with the release, which the download is
+// verified against instead of the pkgs server's signatures.
+type GitHubVersionSource struct {
+	// Repo is the repository whose releases are used, like
+	// "tailscale/tailscale", which is the default.
+	Repo string
+	// APIAddr is the address of the GitHub API. Empty means the default,
+	// "https://api.github.com".
+	APIAddr string
+	// Token, if set, authenticates API requests, which GitHub allows many
+	// more of than anonymous ones. Empty means $GITHUB_TOKEN.
+	Token string
+	// TLSConfig, if non-nil, is used for TLS connections to GitHub.
+	TLSConfig *tls.Config
+	// Proxy, if non-nil, is used instead of the proxy from the environment.
+	Proxy *url.URL
+	// SourceAddr, if valid, is the local address to connect from.
+	SourceAddr netip.Addr
+}
+
+// githubRelease is a release, as returned by the GitHub releases API.
+type githubRelease struct {
+	TagName     string        `json:"tag_name"`
+	Draft       bool          `json:"draft"`
+	PublishedAt time.Time     `json:"published_at"`
+	Assets      []githubAsset `json:"assets"`
+}
+
+// githubAsset is a file attached to a githubRelease.
+type githubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// asset returns the first asset of r named one of names, or nil if none is.
+func (r *githubRelease) asset(names ...string) *githubAsset {
+	for _, name := range names {
+		for i, a := range r.Assets {
+			if a.Name == name {
+				return &r.Assets[i]
+			}
+		}
+	}
+	return nil
+}
+
+// githubSumsAssets are the names that the SHA-256 checksums of all of a
+// release's assets are published under, in the format of sha256sum.
+var githubSumsAssets = []string{"SHA256SUMS", "sha256sums.txt", "checksums.txt"}
+
+// errNotFoundOnGitHub is returned by GitHubVersionSource.get for a 404.
+var errNotFoundOnGitHub = errors.New("not found on GitHub")
+
+// publishedOnGitHub reports whether packages for goos are published as
+// GitHub release assets.
+func publishedOnGitHub(goos string) bool {
+	return goos == "windows" || goos == "linux"
+}
+
+// githubAssetNames returns the names, most likely first, that the package of
+// ver for goos and goarch may have as a release asset. Assets aren't always
+// named like the pkgs server's packages, so the names with the OS spelled out
+// are accepted too.
+func githubAssetNames(ver, goos, goarch string) []string {
+	switch goos {
+	case "windows":
+		return []string{
+			path.Base(msiPath("", ver, goarch)),
+			fmt.Sprintf("tailscale-setup-%s-windows-%s.msi", ver, msiArch(goarch)),
+		}
+	case "linux":
+		return []string{
+			path.Base(tarballPath("", ver, goarch)),
+			fmt.Sprintf("tailscale_%s_linux_%s.tgz", ver, goarch),
+			fmt.Sprintf("tailscale-%s-linux-%s.tar.gz", ver, goarch),
+		}
+	}
+	return nil
+}
+
+func (s GitHubVersionSource) Latest(ctx context.Context, track, goos, goarch string) (*Release, error) {
+	if track == "" {
+		track = CurrentTrack
+	}
+	if !publishedOnGitHub(goos) {
+		return nil, fmt.Errorf("Tailscale for %s is not published as GitHub release assets", goos)
+	}
+	var releases []githubRelease
+	if err := s.get(ctx, "releases?per_page=100", &releases); err != nil {
+		return nil, err
+	}
+	var latest *githubRelease
+	var latestVer string
+	for i, r := range releases {
+		ver, ok := strings.CutPrefix(r.TagName, "v")
+		if !ok || r.Draft {
+			continue
+		}
+		if t, err := versionToTrack(ver); err != nil || t != track {
+			continue
+		}
+		if r.asset(githubAssetNames(ver, goos, goarch)...) == nil {
+			continue
+		}
+		if latest == nil || CompareVersions(ver, latestVer) > 0 {
+			latest, latestVer = &releases[i], ver
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no release on the %s track of github.com/%s has a package for %s/%s", track, s.repo(), goos, goarch)
+	}
+	return s.release(ctx, latest, latestVer, goos, goarch)
+}
+
+// Release returns the release of ver for goos and goarch.
+func (s GitHubVersionSource) Release(ctx context.Context, ver, goos, goarch string) (*Release, error) {
+	if !publishedOnGitHub(goos) {
+		return nil, fmt.Errorf("Tailscale for %s is not published as GitHub release assets", goos)
+	}
+	var r githubRelease
+	if err := s.get(ctx, "releases/tags/v"+url.PathEscape(ver), &r); err != nil {
+		if errors.Is(err, errNotFoundOnGitHub) {
+			return nil, fmt.Errorf("version %s not found in the releases of github.com/%s", ver, s.repo())
+		}
+		return nil, err
+	}
+	return s.release(ctx, &r, ver, goos, goarch)
+}
+
+// release returns the Release of ver for goos and goarch from r, with the
+// checksum of its package.
+func (s GitHubVersionSource) release(ctx context.Context, r *githubRelease, ver, goos, goarch string) (*Release, error) {
+	a := r.asset(githubAssetNames(ver, goos, goarch)...)
+	if a == nil {
+		return nil, fmt.Errorf("release %s of github.com/%s has no package for %s/%s", r.TagName, s.repo(), goos, goarch)
+	}
+	sum, err := s.assetSHA256(ctx, r, a)
+	if err != nil {
+		return nil, err
+	}
+	return &Release{Version: ver, Date: r.PublishedAt, SHA256: sum, URL: a.URL}, nil
+}
+
+// assetSHA256 returns the hex SHA-256 digest of a as published with r, either
+// in a file of its own named like a with a ".sha256" suffix, or in one of
+// githubSumsAssets.
+func (s GitHubVersionSource) assetSHA256(ctx context.Context, r *githubRelease, a *githubAsset) (string, error) {
+	if sa := r.asset(a.Name + ".sha256"); sa != nil {
+		b, err := s.fetchAsset(ctx, sa)
+		if err != nil {
+			return "", err
+		}
+		// Either just the digest or a line of sha256sum output.
+		if f := strings.Fields(string(b)); len(f) > 0 && isHexSHA256(f[0]) {
+			return strings.ToLower(f[0]), nil
+		}
+		return "", fmt.Errorf("invalid checksum file %s in release %s", sa.Name, r.TagName)
+	}
+	if sa := r.asset(githubSumsAssets...); sa != nil {
+		b, err := s.fetchAsset(ctx, sa)
+		if err != nil {
+			return "", err
+		}
+		sc := bufio.NewScanner(strings.NewReader(string(b)))
+		for sc.Scan() {
+			f := strings.Fields(sc.Text())
+			if len(f) == 2 && strings.TrimPrefix(f[1], "*") == a.Name && isHexSHA256(f[0]) {
+				return strings.ToLower(f[0]), nil
+			}
+		}
+		return "", fmt.Errorf("%s in release %s has no checksum for %s; refusing to install it", sa.Name, r.TagName, a.Name)
+	}
+	return "", fmt.Errorf("release %s has no published checksums for %s; refusing to install it", r.TagName, a.Name)
+}
+
+// isHexSHA256 reports whether s looks like a hex SHA-256 digest.
+func isHexSHA256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s GitHubVersionSource) repo() string {
+	return cmp.Or(s.Repo, defaultGitHubRepo)
+}
+
+func (s GitHubVersionSource) client() *http.Client {
+	return newPkgsClient(30*time.Second, s.TLSConfig, s.Proxy, s.SourceAddr)
+}
+
+// get fetches the API endpoint at p, relative to the repository, and decodes
+// its JSON response into v.
+func (s GitHubVersionSource) get(ctx context.Context, p string, v any) error {
+	apiAddr := strings.TrimSuffix(cmp.Or(s.APIAddr, defaultGitHubAPIAddr), "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/repos/%s/%s", apiAddr, s.repo(), p), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := cmp.Or(s.Token, os.Getenv("GITHUB_TOKEN")); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	hc := s.client()
+	defer hc.CloseIdleConnections()
+	res, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching GitHub releases: %w", err)
+	}
+	defer res.Body.Close()
+	if err := githubResponseError(res); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding GitHub releases: %w", err)
+	}
+	return nil
+}
+
+// maxGitHubSumsSize is the largest checksum file that fetchAsset reads.
+const maxGitHubSumsSize = 1 << 20
+
+// fetchAsset returns the contents of the small asset a, like a checksum file.
+func (s GitHubVersionSource) fetchAsset(ctx context.Context, a *githubAsset) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	hc := s.client()
+	defer hc.CloseIdleConnections()
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", a.Name, err)
+	}
+	defer res.Body.Close()
+	if err := githubResponseError(res); err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", a.Name, err)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxGitHubSumsSize))
+}
+
+// githubResponseError returns the error for the unsuccessful response res
+// from GitHub, or nil if it succeeded. Running out of GitHub's rate limit is
+// reported with when it resets.
+func githubResponseError(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errNotFoundOnGitHub
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		retryAfter := res.Header.Get("Retry-After")
+		if res.Header.Get("X-RateLimit-Remaining") != "0" && retryAfter == "" {
+			break
+		}
+		msg := "GitHub API rate limit exceeded"
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			msg += fmt.Sprintf("; retry in %v", time.Duration(secs)*time.Second)
+		} else if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			msg += fmt.Sprintf("; it resets at %v", time.Unix(reset, 0).Format(time.RFC3339))
+		}
+		return errors.New(msg + "; setting $GITHUB_TOKEN to a GitHub token raises the limit")
+	}
+	return fmt.Errorf("GitHub: %v", res.Status)
+}
+
+// githubSource returns the GitHubVersionSource for FromGitHub.
+func (up *Updater) githubSource() GitHubVersionSource {
+	if s, ok := up.VersionSource.(GitHubVersionSource); ok {
+		return s
+	}
+	return GitHubVersionSource{TLSConfig: up.TLSConfig, Proxy: up.Proxy, SourceAddr: up.SourceAddr}
+}
+
+// resolveGitHubRelease returns the version to install with FromGitHub, which
+// is up.Version if set, and remembers its release for downloadURLToFile.
+func (up *Updater) resolveGitHubRelease() (string, error) {
+	ctx, cancel := up.context()
+	defer cancel()
+	var rel *Release
+	var err error
+	if up.Version != "" {
+		rel, err = up.githubSource().Release(ctx, up.Version, runtime.GOOS, up.arch())
+	} else {
+		rel, err = up.githubSource().Latest(ctx, up.Track, runtime.GOOS, up.arch())
+	}
+	if err != nil {
+		return "", err
+	}
+	up.githubRelease = rel
+	return rel.Version, nil
+}
+
+// downloadGitHubAsset downloads the package of rel to dst and checks it
+// against rel.SHA256. Like the pkgs server downloads, the file only gets its
+// final name once it's verified.
+func (up *Updater) downloadGitHubAsset(rel *Release, dst string) error {
+	up.Logf("Downloading %s", rel.URL)
+	ctx, cancel := up.context()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", rel.URL, nil)
+	if err != nil {
+		return err
+	}
+	hc := newPkgsClient(0, up.TLSConfig, up.Proxy, up.SourceAddr)
+	defer hc.CloseIdleConnections()
+	res, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", rel.URL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: %v", rel.URL, res.Status)
+	}
+	tmp := dst + ".unverified"
+	if err := writeFile(res.Body, tmp, 0644); err != nil {
+		return fmt.Errorf("downloading %s: %w", rel.URL, err)
+	}
+	if fi, err := os.Stat(tmp); err == nil {
+		up.reportDownload(fi.Size(), fi.Size())
+	}
+	if err := checkSHA256(tmp, rel.SHA256); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%s doesn't match the checksum published with the release: %w", path.Base(rel.URL), err)
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,228 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeGitHub serves the GitHub releases API for tailscale/tailscale with
+// releases, whose assets are served with their names as contents, except for
+// SHA256SUMS, which has the digests of the other assets.
+func fakeGitHub(t *testing.T, releases []githubRelease) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/tailscale/tailscale/releases" {
+			json.NewEncoder(w).Encode(releases)
+			return
+		}
+		if tag, ok := strings.CutPrefix(r.URL.Path, "/repos/tailscale/tailscale/releases/tags/"); ok {
+			for _, rel := range releases {
+				if rel.TagName == tag {
+					json.NewEncoder(w).Encode(rel)
+					return
+				}
+			}
+			http.NotFound(w, r)
+			return
+		}
+		if name, ok := strings.CutPrefix(r.URL.Path, "/download/"); ok {
+			tag, name, _ := strings.Cut(name, "/")
+			if name != "SHA256SUMS" {
+				fmt.Fprint(w, name)
+				return
+			}
+			for _, rel := range releases {
+				if rel.TagName != tag {
+					continue
+				}
+				for _, a := range rel.Assets {
+					if a.Name != "SHA256SUMS" {
+						fmt.Fprintf(w, "%x  %s\n", sha256.Sum256([]byte(a.Name)), a.Name)
+					}
+				}
+			}
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	// Point the assets at srv, which isn't known until it's started.
+	for i := range releases {
+		for j := range releases[i].Assets {
+			a := &releases[i].Assets[j]
+			a.URL = fmt.Sprintf("%s/download/%s/%s", srv.URL, releases[i].TagName, a.Name)
+		}
+	}
+	return srv
+}
+
+func TestGitHubVersionSource(t *testing.T) {
+	releases := []githubRelease{
+		{TagName: "v1.72.0", Assets: []githubAsset{{Name: "tailscale_1.72.0_amd64.tgz"}, {Name: "SHA256SUMS"}}},
+		// Newer, but without a package for linux/amd64.
+		{TagName: "v1.74.0", Assets: []githubAsset{{Name: "tailscale_1.74.0_arm64.tgz"}, {Name: "SHA256SUMS"}}},
+		// Drafts aren't released yet.
+		{TagName: "v1.76.0", Draft: true, Assets: []githubAsset{{Name: "tailscale_1.76.0_amd64.tgz"}, {Name: "SHA256SUMS"}}},
+		{TagName: "v1.73.5", Assets: []githubAsset{{Name: "tailscale-1.73.5-linux-amd64.tar.gz"}, {Name: "SHA256SUMS"}}},
+		{TagName: "v1.70.0", Assets: []githubAsset{{Name: "tailscale-setup-1.70.0-amd64.msi"}, {Name: "SHA256SUMS"}}},
+		// No checksums.
+		{TagName: "v1.68.0", Assets: []githubAsset{{Name: "tailscale_1.68.0_amd64.tgz"}}},
+	}
+	srv := fakeGitHub(t, releases)
+	src := GitHubVersionSource{APIAddr: srv.URL}
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		lookup  func() (*Release, error)
+		want    string // name of the asset that the release is for
+		wantErr string
+	}{
+		{
+			name:   "latest-stable",
+			lookup: func() (*Release, error) { return src.Latest(ctx, StableTrack, "linux", "amd64") },
+			want:   "tailscale_1.72.0_amd64.tgz",
+		},
+		{
+			name:   "latest-unstable-os-in-name",
+			lookup: func() (*Release, error) { return src.Latest(ctx, UnstableTrack, "linux", "amd64") },
+			want:   "tailscale-1.73.5-linux-amd64.tar.gz",
+		},
+		{
+			name:   "latest-windows",
+			lookup: func() (*Release, error) { return src.Latest(ctx, StableTrack, "windows", "amd64") },
+			want:   "tailscale-setup-1.70.0-amd64.msi",
+		},
+		{
+			name:    "latest-none",
+			lookup:  func() (*Release, error) { return src.Latest(ctx, StableTrack, "linux", "riscv64") },
+			wantErr: "no release on the stable track of github.com/tailscale/tailscale has a package for linux/riscv64",
+		},
+		{
+			name:    "latest-unpublished-os",
+			lookup:  func() (*Release, error) { return src.Latest(ctx, StableTrack, "darwin", "arm64") },
+			wantErr: "Tailscale for darwin is not published as GitHub release assets",
+		},
+		{
+			name:   "version",
+			lookup: func() (*Release, error) { return src.Release(ctx, "1.74.0", "linux", "arm64") },
+			want:   "tailscale_1.74.0_arm64.tgz",
+		},
+		{
+			name:    "version-not-found",
+			lookup:  func() (*Release, error) { return src.Release(ctx, "1.74.2", "linux", "arm64") },
+			wantErr: "version 1.74.2 not found in the releases of github.com/tailscale/tailscale",
+		},
+		{
+			name:    "version-without-checksums",
+			lookup:  func() (*Release, error) { return src.Release(ctx, "1.68.0", "linux", "amd64") },
+			wantErr: "release v1.68.0 has no published checksums for tailscale_1.68.0_amd64.tgz; refusing to install it",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel, err := tt.lookup()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(rel.URL, "/"+tt.want) {
+				t.Errorf("URL = %q, want one for %q", rel.URL, tt.want)
+			}
+			if want := fmt.Sprintf("%x", sha256.Sum256([]byte(tt.want))); rel.SHA256 != want {
+				t.Errorf("SHA256 = %q, want %q", rel.SHA256, want)
+			}
+		})
+	}
+}
+
+func TestGitHubRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		http.Error(w, `{"message": "API rate limit exceeded"}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+	_, err := GitHubVersionSource{APIAddr: srv.URL}.Latest(context.Background(), StableTrack, "linux", "amd64")
+	if err == nil || !strings.Contains(err.Error(), "GitHub API rate limit exceeded; it resets at ") || !strings.Contains(err.Error(), "$GITHUB_TOKEN") {
+		t.Errorf("got error %v, want a rate limit error", err)
+	}
+}
+
+func TestDownloadGitHubAsset(t *testing.T) {
+	srv := fakeGitHub(t, []githubRelease{
+		{TagName: "v1.72.0", Assets: []githubAsset{{Name: "tailscale_1.72.0_amd64.tgz"}, {Name: "SHA256SUMS"}}},
+	})
+	rel, err := GitHubVersionSource{APIAddr: srv.URL}.Release(context.Background(), "1.72.0", "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := &Updater{Arguments: Arguments{Logf: t.Logf}}
+	dst := filepath.Join(t.TempDir(), "tailscale_1.72.0_amd64.tgz")
+
+	if err := up.downloadGitHubAsset(rel, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(dst); err != nil || string(got) != "tailscale_1.72.0_amd64.tgz" {
+		t.Errorf("downloaded %q, %v", got, err)
+	}
+
+	os.Remove(dst)
+	bad := *rel
+	bad.SHA256 = fmt.Sprintf("%x", sha256.Sum256([]byte("something else")))
+	if err := up.downloadGitHubAsset(&bad, dst); err == nil || !strings.Contains(err.Error(), "doesn't match the checksum published with the release") {
+		t.Errorf("got error %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("the package was saved despite the checksum mismatch: %v", err)
+	}
+	if _, err := os.Stat(dst + ".unverified"); !os.IsNotExist(err) {
+		t.Errorf("the unverified download was left behind: %v", err)
+	}
+}
+
+func TestFromGitHubValidate(t *testing.T) {
+	noop := func(string) bool { return false }
+	for _, args := range []Arguments{
+		{LocalFile: "tailscale.tgz"},
+		{Rollback: true},
+		{SelfOnly: true},
+		{VerifyOnly: true},
+		{PkgsAddr: "https://pkgs.example.com"},
+		{VersionSource: ManifestVersionSource{Path: "versions.json"}},
+	} {
+		args.FromGitHub = true
+		args.Confirm = noop
+		args.Logf = t.Logf
+		if err := args.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded; want error", args)
+		}
+	}
+	for _, args := range []Arguments{
+		{},
+		{Version: "1.72.0"},
+		{VersionSource: GitHubVersionSource{Repo: "example/fork"}},
+	} {
+		args.FromGitHub = true
+		args.Confirm = noop
+		args.Logf = t.Logf
+		if err := args.validate(); err != nil {
+			t.Errorf("validate(%+v) = %v; want nil", args, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"tailscale.com/clientupdate/distsign"
+)
+
+// localPackage describes a package file given in Arguments.LocalFile.
+type localPackage struct {
+	path    string
+	kind    string // "tgz", "msi", "deb" or "rpm"
+	version string
+	arch    string // as spelled in the file name
+
+	verified bool // whether it matched an adjacent .sha256 file
+}
+
+var (
+	// tailscale_1.2.3_amd64.tgz, tailscale_1.2.3_amd64.deb,
+	// tailscale_1.2.3_x86_64.rpm
+	localPkgRE = regexp.MustCompile(`^tailscale_(\d+\.\d+\.\d+)_([a-z0-9_]+)\.(tgz|deb|rpm)$`)
+	// tailscale-setup-1.2.3-amd64.msi
+	localMSIRE = regexp.MustCompile(`^tailscale-setup-(\d+\.\d+\.\d+)-([a-z0-9]+)\.msi$`)
+)
+
+// resolveLocalPackage identifies the package file at path from its name, checks
+// that it can be installed on this platform, and verifies it against an
+// adjacent path+".sha256" file, if one exists.
+func resolveLocalPackage(path string) (*localPackage, error) {
+	pkg, err := parseLocalPackageName(path, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.verified, err = verifyLocalSHA256(path); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// parseLocalPackageName is the part of resolveLocalPackage that parses the file
+// name, for the given GOOS and GOARCH.
+func parseLocalPackageName(path, goos, goarch string) (*localPackage, error) {
+	name := filepath.Base(path)
+	pkg := &localPackage{path: path}
+	if m := localPkgRE.FindStringSubmatch(name); m != nil {
+		pkg.version, pkg.arch, pkg.kind = m[1], m[2], m[3]
+	} else if m := localMSIRE.FindStringSubmatch(name); m != nil {
+		pkg.version, pkg.arch, pkg.kind = m[1], m[2], "msi"
+	} else {
+		return nil, fmt.Errorf("%q is not a recognized Tailscale package file name, like tailscale_1.2.3_amd64.tgz or tailscale-setup-1.2.3-amd64.msi", name)
+	}
+
+	wantOS := "linux"
+	if pkg.kind == "msi" {
+		wantOS = "windows"
+	}
+	if goos != wantOS {
+		return nil, fmt.Errorf("%s packages cannot be installed on %s", pkg.kind, goos)
+	}
+	if want := localPackageArch(pkg.kind, goarch); pkg.arch != want {
+		return nil, fmt.Errorf("%s is built for %s, but this system needs %s", name, pkg.arch, want)
+	}
+	return pkg, nil
+}
+
+// localPackageArch returns how goarch is spelled in file names of packages of
+// the given kind.
+func localPackageArch(kind, goarch string) string {
+	var m map[string]string
+	switch kind {
+	case "msi":
+		return msiArch(goarch)
+	case "deb":
+		m = map[string]string{"386": "i386", "arm": "armhf"}
+	case "rpm":
+		m = map[string]string{"amd64": "x86_64", "arm64": "aarch64", "386": "i386", "arm": "armv7hl"}
+	}
+	if a, ok := m[goarch]; ok {
+		return a
+	}
+	return goarch
+}
+
+// verifyLocalSHA256 checks the file at path against the hex SHA-256 digest in
+// path+".sha256", if that file exists. verified reports whether it did; a
+// mismatch is an error.
+func verifyLocalSHA256(path string) (verified bool, err error) {
+	sum, err := os.ReadFile(path + ".sha256")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	want, err := parseSHA256File(sum)
+	if err != nil {
+		return false, fmt.Errorf("%s.sha256: %w", path, err)
+	}
+	got, err := fileSHA256(path)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(got, want) {
+		return false, fmt.Errorf("SHA-256 of %s is %x, want %x from %s.sha256; not installing it", path, got, want, path)
+	}
+	return true, nil
+}
+
+// writeSHA256File writes the hex SHA-256 digest of the file at path to
+// path+".sha256", in the sha256sum format that verifyLocalSHA256 reads.
+func writeSHA256File(path string) error {
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	sum := fmt.Sprintf("%x  %s\n", digest, filepath.Base(path))
+	return os.WriteFile(path+".sha256", []byte(sum), 0644)
+}
+
+// checkSHA256 returns an error unless the file at path has the hex SHA-256
+// digest want, such as one computed when the file was verified, so that a file
+// replaced or truncated since then isn't trusted.
+func checkSHA256(path, want string) error {
+	wantDigest, err := hex.DecodeString(want)
+	if err != nil || len(wantDigest) != sha256.Size {
+		return fmt.Errorf("invalid SHA-256 digest %q", want)
+	}
+	got, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, wantDigest) {
+		return fmt.Errorf("SHA-256 of %s is %x, want %s; it changed after it was verified", path, got, want)
+	}
+	return nil
+}
+
+// fileSHA256 returns the SHA-256 digest of the file at path.
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// parseSHA256File returns the digest in the contents of a .sha256 file, which
+// is either a bare hex SHA-256 digest or sha256sum's "<digest>  <name>" format.
+// Anything after the first whitespace-delimited token is ignored.
+func parseSHA256File(b []byte) ([]byte, error) {
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return nil, errors.New("empty; want a hex SHA-256 digest")
+	}
+	digest := fields[0]
+	if len(digest) != hex.EncodedLen(sha256.Size) {
+		return nil, fmt.Errorf("digest %q has %d characters; want %d hex characters", digest, len(digest), hex.EncodedLen(sha256.Size))
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, fmt.Errorf("digest %q is not hex: %w", digest, err)
+	}
+	return sum, nil
+}
+
+// verifyLocalSignature checks the signature of the package file pkg like a
+// download from the pkgs server is checked. Tarballs are checked against the
+// signature published next to them on the pkgs server, which needs network
+// access to it, and MSIs by their Authenticode signature when installed. The
+// pkgs server publishes no such signature for deb and rpm files, so those, and
+// tarballs whose signature can't be fetched, are only installed with
+// AllowUnsigned.
+func (up *Updater) verifyLocalSignature(pkg *localPackage) error {
+	name := filepath.Base(pkg.path)
+	if up.AllowUnsigned {
+		up.Logf("note: installing %s without checking its signature", name)
+		return nil
+	}
+	switch pkg.kind {
+	case "msi":
+		return nil
+	case "tgz":
+		c, err := distsign.NewClient(up.Logf, up.PkgsAddr)
+		if err != nil {
+			return err
+		}
+		c.SetTLSConfig(up.TLSConfig)
+		c.SetProxy(up.Proxy)
+		c.SetSourceAddr(up.SourceAddr)
+		if err := c.ValidateLocalBinary(tarballPath(up.Track, pkg.version, runtime.GOARCH), pkg.path); err != nil {
+			return fmt.Errorf("verifying the signature of %s: %w; use --allow-unsigned to install it without a signature check", name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s packages have no signature that can be checked; use --allow-unsigned to install %s anyway", pkg.kind, name)
+}
+
+// updateFromLocalFile installs the package file in up.LocalFile without
+// downloading anything.
+func (up *Updater) updateFromLocalFile() error {
+	if runtime.GOOS != "windows" {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+	}
+	path, err := filepath.Abs(up.LocalFile)
+	if err != nil {
+		return err
+	}
+	pkg, err := resolveLocalPackage(path)
+	if err != nil {
+		return err
+	}
+	if pkg.verified {
+		up.Logf("%s matches the checksum in %s.sha256", filepath.Base(path), filepath.Base(path))
+	} else {
+		// Packages installed with apt, dnf, yum or zypper from a file are
+		// not checked against any repository signing key either, so
+		// this is the only check there is for them.
+		up.Logf("note: no %s.sha256 next to the package; installing it without verifying its checksum", filepath.Base(path))
+	}
+	// Treat the file like an explicitly requested version.
+	if up.Track, err = versionToTrack(pkg.version); err != nil {
+		return err
+	}
+	up.Version = pkg.version
+	if err := up.verifyLocalSignature(pkg); err != nil {
+		return err
+	}
+	if !up.confirm(pkg.version) {
+		return nil
+	}
+
+	var cmd *exec.Cmd
+	switch pkg.kind {
+	case "msi":
+		return up.installMSIFromFile(path)
+	case "tgz":
+		return up.installLinuxTarball(path)
+	case "deb":
+		apt := aptCommand(haveExecutable)
+		if apt == "" {
+			return errors.New("cannot install deb packages: neither apt-get nor apt found")
+		}
+		cmd = exec.Command(apt, "install", "--yes", "--allow-downgrades", path)
+	case "rpm":
+		switch {
+		case haveExecutable("dnf"):
+			cmd = exec.Command("dnf", "install", "--assumeyes", path)
+		case haveExecutable("yum"):
+			cmd = exec.Command("yum", "install", "--assumeyes", path)
+		case haveExecutable("zypper"):
+			cmd = exec.Command("zypper", "--non-interactive", "install", "--oldpackage", path)
+		default:
+			return errors.New("cannot install rpm packages: none of dnf, yum or zypper found")
+		}
+	}
+	cmd.Stdout = up.Stdout
+	cmd.Stderr = up.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("installing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLocalPackageName(t *testing.T) {
+	tests := []struct {
+		name        string
+		goos        string
+		goarch      string
+		wantKind    string
+		wantVersion string
+		wantErr     string
+	}{
+		{name: "tailscale_1.70.0_amd64.tgz", goos: "linux", goarch: "amd64", wantKind: "tgz", wantVersion: "1.70.0"},
+		{name: "tailscale_1.70.0_arm.tgz", goos: "linux", goarch: "arm", wantKind: "tgz", wantVersion: "1.70.0"},
+		{name: "tailscale_1.70.0_armhf.deb", goos: "linux", goarch: "arm", wantKind: "deb", wantVersion: "1.70.0"},
+		{name: "tailscale_1.71.2_x86_64.rpm", goos: "linux", goarch: "amd64", wantKind: "rpm", wantVersion: "1.71.2"},
+		{name: "tailscale-setup-1.70.0-x86.msi", goos: "windows", goarch: "386", wantKind: "msi", wantVersion: "1.70.0"},
+		{name: "tailscale-setup-1.70.0-arm64.msi", goos: "windows", goarch: "arm64", wantKind: "msi", wantVersion: "1.70.0"},
+		{name: "tailscale_1.70.0_arm64.deb", goos: "linux", goarch: "amd64", wantErr: "built for arm64, but this system needs amd64"},
+		{name: "tailscale_1.70.0_amd64.rpm", goos: "linux", goarch: "amd64", wantErr: "built for amd64, but this system needs x86_64"},
+		{name: "tailscale-setup-1.70.0-amd64.msi", goos: "linux", goarch: "amd64", wantErr: "msi packages cannot be installed on linux"},
+		{name: "tailscale_1.70.0_amd64.deb", goos: "windows", goarch: "amd64", wantErr: "deb packages cannot be installed on windows"},
+		{name: "tailscale.tgz", goos: "linux", goarch: "amd64", wantErr: "not a recognized Tailscale package file name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg, err := parseLocalPackageName(filepath.Join("dl", tt.name), tt.goos, tt.goarch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pkg.kind != tt.wantKind || pkg.version != tt.wantVersion {
+				t.Errorf("got kind %q version %q, want %q %q", pkg.kind, pkg.version, tt.wantKind, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestVerifyLocalSHA256(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tailscale_1.70.0_amd64.tgz")
+	if err := os.WriteFile(path, []byte("package"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("package")))
+
+	// No .sha256 file is fine.
+	if verified, err := verifyLocalSHA256(path); err != nil || verified {
+		t.Errorf("without .sha256: got %v, %v; want false, nil", verified, err)
+	}
+
+	for _, tt := range []struct {
+		contents string
+		wantErr  bool
+	}{
+		{contents: sum + "\n"},
+		{contents: sum + "  tailscale_1.70.0_amd64.tgz\n"},
+		{contents: fmt.Sprintf("%x\n", sha256.Sum256([]byte("other"))), wantErr: true},
+		{contents: "not-hex\n", wantErr: true},
+		{contents: "", wantErr: true},
+	} {
+		if err := os.WriteFile(path+".sha256", []byte(tt.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		verified, err := verifyLocalSHA256(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("verifyLocalSHA256 with %q: got error %v, want error %v", tt.contents, err, tt.wantErr)
+		}
+		if verified != !tt.wantErr {
+			t.Errorf("verifyLocalSHA256 with %q: verified = %v, want %v", tt.contents, verified, !tt.wantErr)
+		}
+	}
+}
+
+func TestCheckSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tailscale-setup-1.70.0-amd64.msi")
+	if err := os.WriteFile(path, []byte("verified package"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("verified package")))
+	if err := checkSHA256(path, sum); err != nil {
+		t.Errorf("verified file: %v", err)
+	}
+	for _, bad := range []string{"", "not-hex", sum[:10]} {
+		if err := checkSHA256(path, bad); err == nil {
+			t.Errorf("digest %q: got nil error", bad)
+		}
+	}
+
+	// A file replaced by a partial download afterwards isn't trusted.
+	if err := os.WriteFile(path, []byte("verified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSHA256(path, sum); err == nil || !strings.Contains(err.Error(), "changed after it was verified") {
+		t.Errorf("replaced file: got error %v, want a mismatch", err)
+	}
+	os.Remove(path)
+	if err := checkSHA256(path, sum); !os.IsNotExist(err) {
+		t.Errorf("missing file: got error %v, want not exist", err)
+	}
+}
+
+func TestParseSHA256File(t *testing.T) {
+	const sum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	tests := []struct {
+		in      string
+		wantErr string
+	}{
+		{in: sum},
+		{in: sum + "\n"},
+		{in: sum + "  tailscale_1.70.0_amd64.tgz\n"},
+		{in: sum + " *tailscale_1.70.0_amd64.tgz\n"},
+		{in: "", wantErr: "empty"},
+		{in: " \n", wantErr: "empty"},
+		{in: sum[:63], wantErr: "has 63 characters"},
+		{in: sum + "00", wantErr: "has 66 characters"},
+		{in: "SHA256 (tailscale_1.70.0_amd64.tgz) = " + sum, wantErr: "has 6 characters"},
+		{in: "z" + sum[1:], wantErr: "is not hex"},
+	}
+	for _, tt := range tests {
+		got, err := parseSHA256File([]byte(tt.in))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseSHA256File(%q) = %v; want error containing %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSHA256File(%q): %v", tt.in, err)
+		} else if hex.EncodeToString(got) != sum {
+			t.Errorf("parseSHA256File(%q) = %x; want %s", tt.in, got, sum)
+		}
+	}
+}
+
+func TestVerifyLocalSignature(t *testing.T) {
+	// A pkgs server without the tarball's signature.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	up := &Updater{Arguments: Arguments{Logf: t.Logf, PkgsAddr: srv.URL, Track: StableTrack}}
+
+	for _, tt := range []struct {
+		name          string
+		kind          string
+		allowUnsigned bool
+		wantErr       string
+	}{
+		{name: "msi", kind: "msi"},
+		{name: "deb", kind: "deb", wantErr: "deb packages have no signature that can be checked; use --allow-unsigned"},
+		{name: "rpm", kind: "rpm", wantErr: "rpm packages have no signature that can be checked; use --allow-unsigned"},
+		{name: "tgz-no-signature", kind: "tgz", wantErr: "use --allow-unsigned to install it without a signature check"},
+		{name: "deb-allow-unsigned", kind: "deb", allowUnsigned: true},
+		{name: "tgz-allow-unsigned", kind: "tgz", allowUnsigned: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tailscale_1.72.0_amd64."+tt.kind)
+			if err := os.WriteFile(path, []byte("package"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			up.AllowUnsigned = tt.allowUnsigned
+			err := up.verifyLocalSignature(&localPackage{path: path, kind: tt.kind, version: "1.72.0"})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
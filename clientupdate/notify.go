@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+)
+
+// checkNotification is the JSON body that NotifyCheckResult posts.
+type checkNotification struct {
+	Hostname        string `json:"hostname"`
+	Current         string `json:"current"`
+	Latest          string `json:"latest"`
+	Track           string `json:"track"`
+	UpdateAvailable bool   `json:"updateAvailable"`
+	Pinned          string `json:"pinned,omitempty"` // version pinned by the update config file
+}
+
+// ValidateWebhookURL checks that webhookURL is an absolute http or https URL
+// that NotifyCheckResult can post to.
+func ValidateWebhookURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", webhookURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an absolute http or https URL", webhookURL)
+	}
+	return nil
+}
+
+// NotifyCheckResult posts res, along with hostname, as JSON to webhookURL, so
+// that a central system can track which machines need updating. It uses the
+// same proxy settings as package downloads.
+func NotifyCheckResult(ctx context.Context, webhookURL, hostname string, res *CheckResult) error {
+	body, err := json.Marshal(checkNotification{
+		Hostname:        hostname,
+		Current:         res.Current,
+		Latest:          res.Latest,
+		Track:           res.Track,
+		UpdateAvailable: res.UpdateAvailable,
+		Pinned:          res.Pinned,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := newPkgsClient(30*time.Second, nil, nil, netip.Addr{})
+	defer hc.CloseIdleConnections()
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %q: %v", webhookURL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotifyCheckResult(t *testing.T) {
+	var got checkNotification
+	var gotMethod, gotType string
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotType = r.Method, r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	res := &CheckResult{Current: "1.56.1", Latest: "1.58.2", Track: StableTrack, UpdateAvailable: true}
+	if err := NotifyCheckResult(context.Background(), srv.URL, "host1", res); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != "POST" || gotType != "application/json" {
+		t.Errorf("got %s with Content-Type %q, want POST with application/json", gotMethod, gotType)
+	}
+	want := checkNotification{Hostname: "host1", Current: "1.56.1", Latest: "1.58.2", Track: StableTrack, UpdateAvailable: true}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	status = http.StatusInternalServerError
+	if err := NotifyCheckResult(context.Background(), srv.URL, "host1", res); err == nil {
+		t.Error("got no error for a 500 response")
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	for _, tt := range []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://example.com/hook"},
+		{url: "http://10.0.0.1:8080/hook"},
+		{url: "example.com/hook", wantErr: true},
+		{url: "ftp://example.com/hook", wantErr: true},
+		{url: "https://", wantErr: true},
+	} {
+		if err := ValidateWebhookURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateWebhookURL(%q): got error %v, want error %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// versionChange is an upgrade or downgrade of the tailscale package found in a
+// package manager's history.
+type versionChange struct {
+	from, to string
+}
+
+// previousVersion returns the version that was installed before current,
+// according to changes in chronological order, or "" if that's not known.
+func previousVersion(changes []versionChange, current string) string {
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if compareVersions(c.to, current) != 0 {
+			continue
+		}
+		if c.from == "" || compareVersions(c.from, current) == 0 {
+			// A reinstall of the current version; keep looking.
+			continue
+		}
+		return c.from
+	}
+	return ""
+}
+
+// errNoPreviousVersion is returned by rollback when there's no record of a
+// previously installed version.
+var errNoPreviousVersion = errors.New("cannot determine the previously installed version of Tailscale; use --version to install a specific version instead")
+
+// rollback reinstalls the version of Tailscale that was installed before the
+// current one, as recorded by the package manager, or on Windows, found in
+// the MSI cache.
+func (up *Updater) rollback() error {
+	if runtime.GOOS == "windows" {
+		return up.rollbackWindows()
+	}
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	var logs []string
+	var parse func([]byte) []versionChange
+	var update func() error
+	switch {
+	case haveExecutable("dpkg") && exec.Command("dpkg", "--status", "tailscale").Run() == nil:
+		logs = dpkgLogFiles("/var/log")
+		parse, update = parseDpkgLog, up.updateDebLike
+	case haveExecutable("zypper"):
+		logs = []string{"/var/log/zypp/history"}
+		parse, update = parseZypperHistory, up.updateZypperLike
+	case haveExecutable("dnf"):
+		logs = []string{"/var/log/dnf.rpm.log"}
+		parse, update = parseDNFRPMLog, up.updateFedoraLike("dnf")
+	default:
+		return errors.New("rolling back is only supported for Tailscale installed with apt, dnf or zypper, and on Windows; use --version to install a specific version instead")
+	}
+
+	var changes []versionChange
+	for _, name := range logs {
+		b, err := readLogFile(name)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				up.Logf("reading %s: %v", name, err)
+			}
+			continue
+		}
+		changes = append(changes, parse(b)...)
+	}
+	prev := previousVersion(changes, up.currentVersion)
+	if prev == "" {
+		return errNoPreviousVersion
+	}
+	return up.installPrevious(prev, update)
+}
+
+// dpkgLogFiles returns the paths of the dpkg logs in dir, including the ones
+// rotated by logrotate, like dpkg.log.1 and dpkg.log.2.gz, oldest first so
+// that their entries are in chronological order.
+func dpkgLogFiles(dir string) []string {
+	type rotated struct {
+		n    int
+		path string
+	}
+	var logs []rotated
+	paths, _ := filepath.Glob(filepath.Join(dir, "dpkg.log.*"))
+	for _, path := range paths {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "dpkg.log."), ".gz")
+		if n, err := strconv.Atoi(suffix); err == nil {
+			logs = append(logs, rotated{n, path})
+		}
+	}
+	// Higher numbers are older.
+	slices.SortFunc(logs, func(a, b rotated) int { return b.n - a.n })
+	var ret []string
+	for _, l := range logs {
+		ret = append(ret, l.path)
+	}
+	return append(ret, filepath.Join(dir, "dpkg.log"))
+}
+
+// maxLogSize is the most that readLogFile reads from a log file.
+const maxLogSize = 64 << 20
+
+// readLogFile returns the contents of the log file at path, decompressing it
+// if it was compressed with gzip when rotated.
+func readLogFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+	return io.ReadAll(io.LimitReader(r, maxLogSize))
+}
+
+// installPrevious installs prev, the previously installed version, with
+// update, treating it like an explicitly requested version so that the
+// downgrade is allowed.
+func (up *Updater) installPrevious(prev string, update func() error) error {
+	track, err := versionToTrack(prev)
+	if err != nil {
+		return err
+	}
+	up.Logf("Rolling back from %s to the previously installed version %s", up.currentVersion, prev)
+	up.Version, up.Track = prev, track
+	return update()
+}
+
+// parseDpkgLog returns the changes to the tailscale package in dpkg.log, whose
+// relevant lines look like:
+//
+//	2024-07-22 10:00:00 upgrade tailscale:amd64 1.68.2 1.70.0
+func parseDpkgLog(log []byte) []versionChange {
+	var changes []versionChange
+	s := bufio.NewScanner(bytes.NewReader(log))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) != 6 {
+			continue
+		}
+		if op := f[2]; op != "upgrade" && op != "downgrade" && op != "install" {
+			continue
+		}
+		if pkg, _, _ := strings.Cut(f[3], ":"); pkg != "tailscale" {
+			continue
+		}
+		from := f[4]
+		if from == "<none>" {
+			from = ""
+		}
+		changes = append(changes, versionChange{from: from, to: f[5]})
+	}
+	return changes
+}
+
+// parseZypperHistory returns the changes to the tailscale package in zypper's
+// history file, in which installs look like:
+//
+//	2024-07-22 10:00:00|install|tailscale|1.70.0-1|x86_64||tailscale-stable|...
+//
+// The history only records the installed versions, so each change is from the
+// version of the install before it.
+func parseZypperHistory(log []byte) []versionChange {
+	var changes []versionChange
+	var last string
+	s := bufio.NewScanner(bytes.NewReader(log))
+	for s.Scan() {
+		f := strings.Split(s.Text(), "|")
+		if len(f) < 4 || f[1] != "install" || f[2] != "tailscale" {
+			continue
+		}
+		ver, _, _ := strings.Cut(f[3], "-")
+		changes = append(changes, versionChange{from: last, to: ver})
+		last = ver
+	}
+	return changes
+}
+
+// parseDNFRPMLog returns the changes to the tailscale package in dnf.rpm.log,
+// in which each upgrade is a pair of lines like:
+//
+//	2024-07-22T10:00:00+0000 SUBDEBUG Upgrade: tailscale-1.70.0-1.x86_64
+//	2024-07-22T10:00:01+0000 SUBDEBUG Upgraded: tailscale-1.68.2-1.x86_64
+func parseDNFRPMLog(log []byte) []versionChange {
+	var changes []versionChange
+	var to string // from the last "Upgrade:" or "Downgrade:" line
+	s := bufio.NewScanner(bytes.NewReader(log))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) != 4 {
+			continue
+		}
+		ver, ok := rpmTailscaleVersion(f[3])
+		if !ok {
+			continue
+		}
+		switch f[2] {
+		case "Install:":
+			changes = append(changes, versionChange{to: ver})
+		case "Upgrade:", "Downgrade:":
+			to = ver
+		case "Upgraded:", "Downgraded:":
+			if to != "" {
+				changes = append(changes, versionChange{from: ver, to: to})
+				to = ""
+			}
+		}
+	}
+	return changes
+}
+
+// rpmTailscaleVersion returns the version of the tailscale package named by
+// the name-version-release.arch string nvra, like
+// "tailscale-1.70.0-1.x86_64". ok is false if nvra is another package.
+func rpmTailscaleVersion(nvra string) (ver string, ok bool) {
+	rest, ok := strings.CutPrefix(nvra, "tailscale-")
+	if !ok || rest == "" || rest[0] < '0' || rest[0] > '9' {
+		return "", false
+	}
+	ver, _, _ = strings.Cut(rest, "-")
+	return ver, true
+}
+
+// previousCachedMSI returns the file name and version of the newest MSI for
+// goarch among names that is older than current, or "" if there is none.
+func previousCachedMSI(names []string, current, goarch string) (best, bestVer string) {
+	for _, name := range names {
+		pkg, err := parseLocalPackageName(name, "windows", goarch)
+		if err != nil || pkg.kind != "msi" {
+			continue
+		}
+		if compareVersions(pkg.version, current) >= 0 {
+			continue
+		}
+		if best == "" || compareVersions(pkg.version, bestVer) > 0 {
+			best, bestVer = name, pkg.version
+		}
+	}
+	return best, bestVer
+}
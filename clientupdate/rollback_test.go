@@ -0,0 +1,179 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPreviousVersion(t *testing.T) {
+	tests := []struct {
+		desc    string
+		parse   func([]byte) []versionChange
+		log     string
+		current string
+		want    string
+	}{
+		{
+			desc:  "dpkg",
+			parse: parseDpkgLog,
+			log: `2024-05-01 10:00:00 install tailscale:amd64 <none> 1.66.4
+2024-06-01 10:00:00 status installed tailscale:amd64 1.66.4
+2024-06-20 10:00:00 upgrade tailscale:amd64 1.66.4 1.68.2
+2024-07-22 10:00:00 upgrade tailscale-archive-keyring:all 1.34 1.35
+2024-07-22 10:00:01 upgrade tailscale:amd64 1.68.2 1.70.0
+`,
+			current: "1.70.0",
+			want:    "1.68.2",
+		},
+		{
+			desc:  "dpkg-reinstall",
+			parse: parseDpkgLog,
+			log: `2024-06-20 10:00:00 upgrade tailscale:amd64 1.66.4 1.68.2
+2024-07-22 10:00:01 upgrade tailscale:amd64 1.68.2 1.70.0
+2024-07-23 10:00:01 upgrade tailscale:amd64 1.70.0 1.70.0
+`,
+			current: "1.70.0-t1a2b3c",
+			want:    "1.68.2",
+		},
+		{
+			desc:    "dpkg-fresh-install",
+			parse:   parseDpkgLog,
+			log:     "2024-07-22 10:00:01 install tailscale:amd64 <none> 1.70.0\n",
+			current: "1.70.0",
+		},
+		{
+			desc:  "dpkg-current-not-logged",
+			parse: parseDpkgLog,
+			log:   "2024-06-20 10:00:00 upgrade tailscale:amd64 1.66.4 1.68.2\n",
+			// Rotated out of the log.
+			current: "1.70.0",
+		},
+		{
+			desc:  "zypper",
+			parse: parseZypperHistory,
+			log: `# 2024-06-20 10:00:00 tailscale-1.68.2-1.x86_64.rpm installed ok
+2024-06-20 10:00:00|install|tailscale|1.68.2-1|x86_64||tailscale-stable|0123|
+2024-07-22 10:00:00|install|tailscale-other|9.9.9-1|x86_64||tailscale-stable|4567|
+2024-07-22 10:00:00|install|tailscale|1.70.0-1|x86_64||tailscale-stable|89ab|
+`,
+			current: "1.70.0",
+			want:    "1.68.2",
+		},
+		{
+			desc:  "dnf",
+			parse: parseDNFRPMLog,
+			log: `2024-05-01T10:00:00+0000 SUBDEBUG Installed: tailscale-1.66.4-1.x86_64
+2024-05-01T10:00:00+0000 SUBDEBUG Install: tailscale-1.66.4-1.x86_64
+2024-06-20T10:00:00+0000 SUBDEBUG Upgrade: tailscale-1.68.2-1.x86_64
+2024-06-20T10:00:01+0000 SUBDEBUG Upgraded: tailscale-1.66.4-1.x86_64
+2024-07-22T10:00:00+0000 SUBDEBUG Upgrade: tailscale-1.70.0-1.x86_64
+2024-07-22T10:00:01+0000 SUBDEBUG Upgraded: tailscale-1.68.2-1.x86_64
+2024-07-22T10:00:02+0000 INFO --- logging initialized ---
+`,
+			current: "1.70.0",
+			want:    "1.68.2",
+		},
+		{
+			desc:  "dnf-after-rollback",
+			parse: parseDNFRPMLog,
+			log: `2024-06-20T10:00:00+0000 SUBDEBUG Upgrade: tailscale-1.68.2-1.x86_64
+2024-06-20T10:00:01+0000 SUBDEBUG Upgraded: tailscale-1.66.4-1.x86_64
+2024-07-22T10:00:00+0000 SUBDEBUG Upgrade: tailscale-1.70.0-1.x86_64
+2024-07-22T10:00:01+0000 SUBDEBUG Upgraded: tailscale-1.68.2-1.x86_64
+2024-07-23T10:00:00+0000 SUBDEBUG Downgrade: tailscale-1.68.2-1.x86_64
+2024-07-23T10:00:01+0000 SUBDEBUG Downgraded: tailscale-1.70.0-1.x86_64
+`,
+			current: "1.68.2",
+			want:    "1.70.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := previousVersion(tt.parse([]byte(tt.log)), tt.current)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviousCachedMSI(t *testing.T) {
+	names := []string{
+		"tailscale-setup-1.66.4-amd64.msi",
+		"tailscale-setup-1.68.2-amd64.msi",
+		"tailscale-setup-1.68.2-arm64.msi",
+		"tailscale-setup-1.69.1-arm64.msi",
+		"tailscale-setup-1.70.0-amd64.msi",
+		// Partial downloads, which haven't been verified.
+		"tailscale-setup-1.69.9-amd64.msi.unverified",
+		"tailscale-setup-1.69.9-amd64.msi.unverified.sig",
+		"install-20240722-100000.000.log",
+	}
+	tests := []struct {
+		current, goarch string
+		wantName        string
+		wantVer         string
+	}{
+		{current: "1.70.0", goarch: "amd64", wantName: "tailscale-setup-1.68.2-amd64.msi", wantVer: "1.68.2"},
+		{current: "1.70.0", goarch: "arm64", wantName: "tailscale-setup-1.69.1-arm64.msi", wantVer: "1.69.1"},
+		{current: "1.66.4", goarch: "amd64"},
+		{current: "1.70.0", goarch: "386"},
+	}
+	for _, tt := range tests {
+		name, ver := previousCachedMSI(names, tt.current, tt.goarch)
+		if name != tt.wantName || ver != tt.wantVer {
+			t.Errorf("previousCachedMSI(%q, %q) = %q, %q; want %q, %q", tt.current, tt.goarch, name, ver, tt.wantName, tt.wantVer)
+		}
+	}
+}
+
+func TestDpkgLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	logs := map[string]string{
+		"dpkg.log":       "2024-07-22 10:00:00 upgrade tailscale:amd64 1.68.2 1.70.0\n",
+		"dpkg.log.1":     "2024-06-22 10:00:00 upgrade tailscale:amd64 1.66.4 1.68.2\n",
+		"dpkg.log.2.gz":  "2024-05-22 10:00:00 upgrade tailscale:amd64 1.64.2 1.66.4\n",
+		"dpkg.log.10.gz": "2024-04-22 10:00:00 upgrade tailscale:amd64 1.62.1 1.64.2\n",
+		"dpkg.log.old":   "not a rotated log\n",
+	}
+	for name, contents := range logs {
+		b := []byte(contents)
+		if strings.HasSuffix(name, ".gz") {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(b)
+			zw.Close()
+			b = buf.Bytes()
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := dpkgLogFiles(dir)
+	var names []string
+	var changes []versionChange
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+		b, err := readLogFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes = append(changes, parseDpkgLog(b)...)
+	}
+	if want := []string{"dpkg.log.10.gz", "dpkg.log.2.gz", "dpkg.log.1", "dpkg.log"}; !slices.Equal(names, want) {
+		t.Errorf("dpkgLogFiles = %q, want %q", names, want)
+	}
+	// The version before 1.66.4 is only in a compressed log.
+	if got := previousVersion(changes, "1.66.4"); got != "1.64.2" {
+		t.Errorf("previousVersion(1.66.4) = %q, want 1.64.2", got)
+	}
+}
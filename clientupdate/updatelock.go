@@ -0,0 +1,39 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import "errors"
+
+var errUpdateInProgress = errors.New("another update is already in progress")
+
+// withUpdateLock wraps fn to hold the update lock while it runs, so that
+// concurrent updates, like a cron job overlapping with a manual run, fail fast
+// with errUpdateInProgress instead of racing each other's package manager.
+//
+// The lock is advisory: if it cannot be set up at all, for example because
+// the caller lacks permissions that fn will complain about anyway, fn runs
+// without it. That's only worth a warning when running as root, as the lock
+// file is in a directory that only root can write to.
+//
+// Dry runs and VerifyOnly don't change the installation, so they run without
+// the lock.
+func (up *Updater) withUpdateLock(fn updateFunction) updateFunction {
+	if up.DryRun || up.VerifyOnly {
+		return fn
+	}
+	return func() error {
+		release, err := acquireUpdateLock()
+		if errors.Is(err, errUpdateInProgress) {
+			return err
+		}
+		if err != nil {
+			if isRoot() {
+				up.Logf("could not take the update lock, continuing without it: %v", err)
+			}
+		} else {
+			defer release()
+		}
+		return fn()
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux || darwin || freebsd || openbsd || netbsd
+
+package clientupdate
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// updateLockPath is the file locked with flock while an update runs. The file
+// itself is left behind; only the lock on it matters. Var allows overriding
+// this in tests.
+var updateLockPath = "/var/run/tailscale-update.lock"
+
+func acquireUpdateLock() (release func(), err error) {
+	f, err := os.OpenFile(updateLockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errUpdateInProgress
+		}
+		return nil, err
+	}
+	// Closing the file releases the lock, including when the process exits.
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,11 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || windows)
+
+package clientupdate
+
+func acquireUpdateLock() (release func(), err error) {
+	// No updates are supported on these platforms.
+	return func() {}, nil
+}
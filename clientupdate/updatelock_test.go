@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux || darwin || freebsd || openbsd || netbsd
+
+package clientupdate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateLock(t *testing.T) {
+	oldPath := updateLockPath
+	updateLockPath = filepath.Join(t.TempDir(), "update.lock")
+	defer func() { updateLockPath = oldPath }()
+
+	up := &Updater{Arguments: Arguments{Logf: t.Logf}}
+	var inner error
+	ran := false
+	err := up.withUpdateLock(func() error {
+		ran = true
+		// A concurrent update fails fast while the lock is held.
+		inner = up.withUpdateLock(func() error {
+			t.Error("concurrent update ran")
+			return nil
+		})()
+		return nil
+	})()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Error("update did not run")
+	}
+	if !errors.Is(inner, errUpdateInProgress) {
+		t.Errorf("concurrent update returned %v, want %v", inner, errUpdateInProgress)
+	}
+
+	// The lock is released afterwards.
+	release, err := acquireUpdateLock()
+	if err != nil {
+		t.Fatalf("acquiring lock after update: %v", err)
+	}
+	release()
+
+	// Without a usable lock file, updates still run.
+	updateLockPath = filepath.Join(t.TempDir(), "missing", "update.lock")
+	ran = false
+	if err := up.withUpdateLock(func() error { ran = true; return nil })(); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Error("update did not run without a lock file")
+	}
+
+	// Dry runs don't take the lock, so they can run alongside an update.
+	updateLockPath = filepath.Join(t.TempDir(), "update.lock")
+	release, err = acquireUpdateLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	dryRun := &Updater{Arguments: Arguments{Logf: t.Logf, DryRun: true}}
+	ran = false
+	if err := dryRun.withUpdateLock(func() error { ran = true; return nil })(); err != nil {
+		t.Fatalf("dry run during an update: %v", err)
+	}
+	if !ran {
+		t.Error("dry run did not run during an update")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+	"tailscale.com/util/winutil"
+)
+
+// updateMutexName is the name of the system-wide mutex held while an update
+// runs.
+const updateMutexName = `Global\TailscaleClientUpdate`
+
+func acquireUpdateLock() (release func(), err error) {
+	if os.Getenv(winMSIEnv) != "" {
+		// This is the re-executed copy of tailscale.exe started by
+		// installMSIFromFile. Its parent still holds the mutex until it
+		// exits, and waiting for it would deadlock.
+		return func() {}, nil
+	}
+	h, err := winutil.CreateAppMutex(updateMutexName)
+	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
+		windows.CloseHandle(h)
+		return nil, errUpdateInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() { windows.CloseHandle(h) }, nil
+}
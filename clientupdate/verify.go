@@ -0,0 +1,185 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"tailscale.com/version"
+	"tailscale.com/version/distro"
+)
+
+// VerifyInstalled checks that the installed tailscale and tailscaled binaries
+// are the ones published for the running version, version.Short(), on the
+// requested track, or the running version's track if none is requested. It
+// prints whether each binary matches, and returns an error if any doesn't.
+//
+// The pkgs server only publishes checksums and signatures of whole packages,
+// not of the binaries in them. On Linux tarball installs, the tarball of the
+// running version is downloaded and its signature checked like for an update,
+// and the installed binaries are compared against the ones in it; nothing is
+// installed. Binaries installed from an MSI or by a package manager cannot be
+// compared against the package they came from, so for those VerifyInstalled
+// returns an error explaining that and suggesting another way to check them.
+func VerifyInstalled(args Arguments) error {
+	if args.Version != "" || args.LocalFile != "" || args.Rollback || args.AllowPrerelease {
+		return errors.New("verifying the installed binaries always checks the running version, and cannot be combined with Version, LocalFile, Rollback or AllowPrerelease")
+	}
+	if args.Arch != "" && args.Arch != runtime.GOARCH {
+		return errors.New("verifying the installed binaries cannot be combined with Arch")
+	}
+	if args.Confirm == nil {
+		// Nothing is installed, so there is nothing to confirm.
+		args.Confirm = func(string) bool { return false }
+	}
+	if err := args.validate(); err != nil {
+		return err
+	}
+	if args.Track == "" {
+		track, err := versionToTrack(version.Short())
+		if err != nil {
+			return err
+		}
+		args.Track = track
+	}
+	up, err := NewUpdater(args)
+	if err != nil {
+		return err
+	}
+	return up.verifyInstalled()
+}
+
+func (up *Updater) verifyInstalled() error {
+	switch {
+	case runtime.GOOS == "windows":
+		return errors.New("the checksums published for Windows are of the MSI installer, not of the binaries it installs, so the installed binaries cannot be compared against them; check the Authenticode signatures of tailscale.exe and tailscaled.exe instead, for example with Get-AuthenticodeSignature in PowerShell")
+	case runtime.GOOS != "linux" || distro.Get() == distro.Synology:
+		return fmt.Errorf("verifying the installed binaries is not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	tailscale, tailscaled, err := binaryPaths()
+	if err != nil {
+		return err
+	}
+	if verify := packageVerifyCommand(tailscale); verify != "" {
+		return fmt.Errorf("%s was installed by the package manager, and the checksums published for it are of the package, not of the binaries in it, so the installed binaries cannot be compared against them; run %q to check the installed files against the package instead", tailscale, verify)
+	}
+
+	ver := up.currentVersion
+	dir, err := os.MkdirTemp("", "tailscale-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	pkgsPath := up.linuxTarballPath(ver)
+	dlPath := filepath.Join(dir, path.Base(pkgsPath))
+	if err := up.downloadURLToFile(pkgsPath, dlPath, tarballContentTypes); err != nil {
+		return fmt.Errorf("downloading Tailscale %s to compare against: %w", ver, err)
+	}
+	want, err := tarballSHA256s(dlPath, "tailscale", "tailscaled")
+	if err != nil {
+		return err
+	}
+	return compareInstalledBinaries(up.Stdout, map[string]string{
+		"tailscale":  tailscale,
+		"tailscaled": tailscaled,
+	}, want, path.Base(pkgsPath))
+}
+
+// packageVerifyCommand returns the command that checks the installed files of
+// the tailscale package against the package manager's records, if a package
+// manager owns the file at path, or "" if none does.
+func packageVerifyCommand(path string) string {
+	switch {
+	case haveExecutable("dpkg") && exec.Command("dpkg", "--search", path).Run() == nil:
+		return "dpkg --verify tailscale"
+	case haveExecutable("rpm") && exec.Command("rpm", "--query", "--file", path).Run() == nil:
+		return "rpm --verify tailscale"
+	case haveExecutable("pacman") && exec.Command("pacman", "--query", "--owns", path).Run() == nil:
+		return "pacman --query --check --check tailscale"
+	}
+	return ""
+}
+
+// tarballSHA256s returns the SHA-256 digests of the files in the tarball at
+// path whose base names are names, keyed by base name. Each of them must be in
+// the tarball exactly once.
+func tarballSHA256s(path string, names ...string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	sums := make(map[string][]byte)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed reading %q: %w", path, err)
+		}
+		name := filepath.Base(th.Name)
+		if !slices.Contains(names, name) {
+			continue
+		}
+		if _, dup := sums[name]; dup {
+			return nil, fmt.Errorf("%q has more than one %s", path, name)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return nil, fmt.Errorf("failed reading %s from %q: %w", name, path, err)
+		}
+		sums[name] = h.Sum(nil)
+	}
+	for _, name := range names {
+		if _, ok := sums[name]; !ok {
+			return nil, fmt.Errorf("%q has no %s", path, name)
+		}
+	}
+	return sums, nil
+}
+
+// compareInstalledBinaries compares the SHA-256 digests of the installed files
+// in installed, keyed by base name, against the published ones in want from
+// the package named pkgName, and prints the result for each to w. It returns
+// an error if any of them doesn't match.
+func compareInstalledBinaries(w io.Writer, installed map[string]string, want map[string][]byte, pkgName string) error {
+	var mismatched []string
+	for _, name := range slices.Sorted(maps.Keys(installed)) {
+		p := installed[name]
+		got, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(got, want[name]) {
+			fmt.Fprintf(w, "%s: OK, matches %s from %s (SHA-256 %x)\n", p, name, pkgName, got)
+			continue
+		}
+		fmt.Fprintf(w, "%s: MISMATCH, SHA-256 is %x, want %x for %s from %s\n", p, got, want[name], name, pkgName)
+		mismatched = append(mismatched, p)
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("%q do not match the published binaries; they may have been modified, or the install is broken", mismatched)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyInstalledBinaries(t *testing.T) {
+	tmp := t.TempDir()
+	tarPath := filepath.Join(tmp, "tailscale_1.70.0_amd64.tgz")
+	genTarball(t, tarPath, map[string]string{
+		"tailscale_1.70.0_amd64/tailscale":          "tailscale v1.70.0",
+		"tailscale_1.70.0_amd64/tailscaled":         "tailscaled v1.70.0",
+		"tailscale_1.70.0_amd64/systemd/tailscaled": "not a binary",
+	})
+	want, err := tarballSHA256s(tarPath, "tailscale", "tailscaled")
+	if err == nil {
+		t.Fatalf("tarballSHA256s succeeded with a duplicate tailscaled: %x", want)
+	}
+	genTarball(t, tarPath, map[string]string{
+		"tailscale_1.70.0_amd64/tailscale":  "tailscale v1.70.0",
+		"tailscale_1.70.0_amd64/tailscaled": "tailscaled v1.70.0",
+	})
+	want, err = tarballSHA256s(tarPath, "tailscale", "tailscaled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, wantSum := want["tailscale"], sha256.Sum256([]byte("tailscale v1.70.0")); !bytes.Equal(got, wantSum[:]) {
+		t.Fatalf("SHA-256 of tailscale is %x, want %x", got, wantSum)
+	}
+	if _, err := tarballSHA256s(tarPath, "tailscale", "derper"); err == nil {
+		t.Fatal("tarballSHA256s succeeded with a missing file")
+	}
+
+	installed := map[string]string{
+		"tailscale":  filepath.Join(tmp, "tailscale"),
+		"tailscaled": filepath.Join(tmp, "tailscaled"),
+	}
+	for _, tt := range []struct {
+		desc       string
+		tailscaled string
+		wantOut    string
+		wantErr    bool
+	}{
+		{
+			desc:       "match",
+			tailscaled: "tailscaled v1.70.0",
+			wantOut:    "tailscaled: OK",
+		},
+		{
+			desc:       "mismatch",
+			tailscaled: "tailscaled v1.70.0, modified",
+			wantOut:    "tailscaled: MISMATCH",
+			wantErr:    true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			for name, content := range map[string]string{"tailscale": "tailscale v1.70.0", "tailscaled": tt.tailscaled} {
+				if err := os.WriteFile(installed[name], []byte(content), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var out bytes.Buffer
+			err := compareInstalledBinaries(&out, installed, want, filepath.Base(tarPath))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), "tailscale: OK") || !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("output %q does not report tailscale as OK and contain %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
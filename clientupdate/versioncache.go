@@ -0,0 +1,127 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"tailscale.com/atomicfile"
+)
+
+// latestVersionCacheTTL is how long a cached latest version lookup is served
+// before pkgs.tailscale.com is asked again.
+const latestVersionCacheTTL = time.Hour
+
+// latestVersionCachePath returns the file that latest version lookups are
+// cached in, in the user's cache directory, or "" if there's none. Unlike the
+// tailscaled state directory, it's writable without root, and its contents
+// may be deleted at any time. Var allows overriding this in tests.
+var latestVersionCachePath = func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tailscale", "latest-version-cache.json")
+}
+
+// latestVersionCacheEntry is a cached result of latestRelease.
+type latestVersionCacheEntry struct {
+	Release
+	Fetched time.Time
+}
+
+// LatestTailscaleRelease returns the latest release for this platform on the
+// given track from pkgs.tailscale.com. If useCache is true, a result fetched
+// within the last hour may be served from an on-disk cache.
+func LatestTailscaleRelease(ctx context.Context, track string, useCache bool) (*Release, error) {
+	return cachedLatestRelease(ctx, PkgsVersionSource{Addr: defaultPkgsAddr}, track, useCache)
+}
+
+// cachedLatestRelease looks up the latest release for this platform on track
+// from src, with an on-disk cache in front of it for pkgs servers. If useCache
+// is false, the cache is not read from, but is still updated with the fresh
+// result. Failures to read or write the cache are ignored, as it's only an
+// optimization; for example, the cache directory may be read-only.
+func cachedLatestRelease(ctx context.Context, src VersionSource, track string, useCache bool) (*Release, error) {
+	if track == "" {
+		track = CurrentTrack
+	}
+	pkgs, isPkgs := src.(PkgsVersionSource)
+	path := latestVersionCachePath()
+	if path == "" || !isPkgs {
+		return src.Latest(ctx, track, runtime.GOOS, runtime.GOARCH)
+	}
+	key := latestVersionCacheKey(pkgs.Addr, track)
+	now := time.Now()
+	if useCache {
+		if rel, ok := readLatestVersionCache(path, key, now); ok {
+			return rel, nil
+		}
+	}
+	rel, err := src.Latest(ctx, track, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+	writeLatestVersionCache(path, key, rel, now)
+	return rel, nil
+}
+
+// latestVersionCacheKey returns the cache key for the latest version on track
+// from pkgsAddr for this OS and architecture.
+func latestVersionCacheKey(pkgsAddr, track string) string {
+	return pkgsAddrOrDefault(pkgsAddr) + "/" + track + "?os=" + runtime.GOOS + "&arch=" + runtime.GOARCH
+}
+
+func loadLatestVersionCache(path string) (map[string]latestVersionCacheEntry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cache map[string]latestVersionCacheEntry
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// readLatestVersionCache returns the cached release for key in the file at
+// path, if it was fetched no longer than latestVersionCacheTTL before now.
+func readLatestVersionCache(path, key string, now time.Time) (rel *Release, ok bool) {
+	cache, err := loadLatestVersionCache(path)
+	if err != nil {
+		return nil, false
+	}
+	ent, ok := cache[key]
+	if !ok || ent.Version == "" {
+		return nil, false
+	}
+	if age := now.Sub(ent.Fetched); age < 0 || age > latestVersionCacheTTL {
+		return nil, false
+	}
+	return &ent.Release, true
+}
+
+// writeLatestVersionCache stores rel as the latest release for key, fetched
+// at now, in the file at path, keeping the entries for other keys.
+func writeLatestVersionCache(path, key string, rel *Release, now time.Time) error {
+	// Start over if the file is missing or corrupt.
+	cache, _ := loadLatestVersionCache(path)
+	if cache == nil {
+		cache = make(map[string]latestVersionCacheEntry)
+	}
+	cache[key] = latestVersionCacheEntry{Release: *rel, Fetched: now}
+	b, err := json.MarshalIndent(cache, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatestVersionCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, ok := readLatestVersionCache(path, "a", now); ok {
+		t.Fatal("got cached version from missing file")
+	}
+	if err := writeLatestVersionCache(path, "a", &Release{Version: "1.70.0"}, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeLatestVersionCache(path, "b", &Release{Version: "1.71.5"}, now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key    string
+		now    time.Time
+		want   string
+		wantOK bool
+	}{
+		{key: "a", now: now, want: "1.70.0", wantOK: true},
+		{key: "a", now: now.Add(59 * time.Minute), want: "1.70.0", wantOK: true},
+		{key: "a", now: now.Add(61 * time.Minute)}, // stale
+		{key: "a", now: now.Add(-time.Minute)},     // fetched in the future
+		{key: "b", now: now},                       // stale
+		{key: "b", now: now.Add(-2 * time.Hour), want: "1.71.5", wantOK: true},
+		{key: "c", now: now}, // missing
+	}
+	for _, tt := range tests {
+		rel, ok := readLatestVersionCache(path, tt.key, tt.now)
+		var got string
+		if rel != nil {
+			got = rel.Version
+		}
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("readLatestVersionCache(%q, %v) = %q, %v; want %q, %v", tt.key, tt.now, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	// A corrupt file is ignored and replaced.
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readLatestVersionCache(path, "a", now); ok {
+		t.Error("got cached version from corrupt file")
+	}
+	if err := writeLatestVersionCache(path, "a", &Release{Version: "1.72.0", SHA256: "abc"}, now); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := readLatestVersionCache(path, "a", now); !ok || got.Version != "1.72.0" || got.SHA256 != "abc" {
+		t.Errorf("after rewrite, got %+v, %v; want 1.72.0 with sha256 abc, true", got, ok)
+	}
+
+	// Entries written before releases were cached still read back.
+	old := fmt.Sprintf(`{"a": {"Version": "1.68.0", "Fetched": %q}}`, now.Format(time.RFC3339))
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := readLatestVersionCache(path, "a", now); !ok || got.Version != "1.68.0" {
+		t.Errorf("old entry: got %+v, %v; want 1.68.0, true", got, ok)
+	}
+}
+
+func TestCachedLatestRelease(t *testing.T) {
+	// The cache directory is created on the first write.
+	cachePath := filepath.Join(t.TempDir(), "tailscale", "cache.json")
+	oldCachePath := latestVersionCachePath
+	latestVersionCachePath = func() string { return cachePath }
+	defer func() { latestVersionCachePath = oldCachePath }()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		v := fmt.Sprintf("1.70.%d", n)
+		fmt.Fprintf(w, `{"Version": %[1]q, "TarballsVersion": %[1]q, "MSIsVersion": %[1]q, "MacZipsVersion": %[1]q, "SPKsVersion": %[1]q}`, v)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	for i, tt := range []struct {
+		useCache     bool
+		want         string
+		wantRequests int32
+	}{
+		{useCache: true, want: "1.70.1", wantRequests: 1},
+		{useCache: true, want: "1.70.1", wantRequests: 1},  // served from the cache
+		{useCache: false, want: "1.70.2", wantRequests: 2}, // --no-cache
+		{useCache: true, want: "1.70.2", wantRequests: 2},  // refreshed by the uncached lookup
+	} {
+		rel, err := cachedLatestRelease(ctx, PkgsVersionSource{Addr: srv.URL}, StableTrack, tt.useCache)
+		if err != nil {
+			t.Fatalf("[%d]: %v", i, err)
+		}
+		if got := rel.Version; got != tt.want {
+			t.Errorf("[%d]: got %q, want %q", i, got, tt.want)
+		}
+		if n := requests.Load(); n != tt.wantRequests {
+			t.Errorf("[%d]: got %d requests, want %d", i, n, tt.wantRequests)
+		}
+	}
+
+	// Lookups for another track are cached separately.
+	rel, err := cachedLatestRelease(ctx, PkgsVersionSource{Addr: srv.URL}, UnstableTrack, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != "1.70.3" {
+		t.Errorf("unstable track: got %q, want 1.70.3", rel.Version)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"tailscale.com/version"
+	"tailscale.com/version/distro"
+)
+
+// VersionList is the result of ListVersions.
+type VersionList struct {
+	Current  string   // currently running version
+	Track    string   // track that Versions were listed from
+	Versions []string // published versions, newest first
+}
+
+// ListVersions lists the versions published on args.Track, or the unstable
+// track with args.AllowPrerelease, or the current track, for this OS and
+// architecture, so that one can be picked for args.Version. They're read from
+// the pkgs server's listing of the track's package files, so it's only
+// supported where packages are downloaded directly: Windows, and Linux other
+// than Synology.
+func ListVersions(args Arguments) (*VersionList, error) {
+	if distro.Get() == distro.Synology {
+		return nil, fmt.Errorf("listing versions is not supported on Synology")
+	}
+	re, err := packageFileRE(runtime.GOOS, args.arch())
+	if err != nil {
+		return nil, err
+	}
+	track := args.Track
+	switch {
+	case track != "":
+	case args.AllowPrerelease:
+		track = UnstableTrack
+	default:
+		track = CurrentTrack
+	}
+	listing, err := fetchTrackListing(args.baseContext(), args.PkgsAddr, args.TLSConfig, args.Proxy, args.SourceAddr, track)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionList{
+		Current:  version.Short(),
+		Track:    track,
+		Versions: parseVersionListing(listing, re),
+	}, nil
+}
+
+// packageFileRE returns a regexp that matches the file names of packages for
+// goos and goarch on the pkgs server, capturing their version.
+func packageFileRE(goos, goarch string) (*regexp.Regexp, error) {
+	const placeholder = "VERSION"
+	var name string
+	switch goos {
+	case "windows":
+		name = path.Base(msiPath("", placeholder, goarch))
+	case "linux":
+		name = path.Base(tarballPath("", placeholder, goarch))
+	default:
+		return nil, fmt.Errorf("listing versions is not supported on %s", goos)
+	}
+	return regexp.Compile(strings.Replace(regexp.QuoteMeta(name), placeholder, `([0-9]+\.[0-9]+\.[0-9]+)`, 1))
+}
+
+// fetchTrackListing returns the HTML listing of the package files on track
+// from the pkgs server at pkgsAddr.
+func fetchTrackListing(ctx context.Context, pkgsAddr string, tlsConf *tls.Config, proxy *url.URL, sourceAddr netip.Addr, track string) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/", pkgsAddrOrDefault(pkgsAddr), track)
+	hc := newPkgsClient(30*time.Second, tlsConf, proxy, sourceAddr)
+	defer hc.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching list of versions: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching list of versions: %v", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 10<<20))
+}
+
+// parseVersionListing returns the versions of the package files matching re
+// in listing, without duplicates, newest first.
+func parseVersionListing(listing []byte, re *regexp.Regexp) []string {
+	var vers []string
+	for _, m := range re.FindAllSubmatch(listing, -1) {
+		if v := string(m[1]); !slices.Contains(vers, v) {
+			vers = append(vers, v)
+		}
+	}
+	slices.SortFunc(vers, func(a, b string) int { return compareVersions(b, a) })
+	return vers
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestParseVersionListing(t *testing.T) {
+	const listing = `<html><body>
+<a href="tailscale_1.9.0_amd64.tgz">tailscale_1.9.0_amd64.tgz</a>
+<a href="tailscale_1.10.0_amd64.tgz">tailscale_1.10.0_amd64.tgz</a>
+<a href="tailscale_1.10.0_amd64.tgz.sha256">tailscale_1.10.0_amd64.tgz.sha256</a>
+<a href="tailscale_1.10.2_arm64.tgz">tailscale_1.10.2_arm64.tgz</a>
+<a href="tailscale_1.8.4_amd64.tgz">tailscale_1.8.4_amd64.tgz</a>
+<a href="tailscale-setup-1.10.4-amd64.msi">tailscale-setup-1.10.4-amd64.msi</a>
+<a href="tailscale-setup-1.10.4-x86.msi">tailscale-setup-1.10.4-x86.msi</a>
+</body></html>`
+	tests := []struct {
+		goos, goarch string
+		want         []string
+		wantErr      bool
+	}{
+		{goos: "linux", goarch: "amd64", want: []string{"1.10.0", "1.9.0", "1.8.4"}},
+		{goos: "linux", goarch: "arm64", want: []string{"1.10.2"}},
+		{goos: "linux", goarch: "arm"},
+		{goos: "windows", goarch: "386", want: []string{"1.10.4"}},
+		{goos: "darwin", goarch: "arm64", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos+"/"+tt.goarch, func(t *testing.T) {
+			re, err := packageFileRE(tt.goos, tt.goarch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := parseVersionListing([]byte(listing), re); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		t.Skipf("listing versions is not supported on %s", runtime.GOOS)
+	}
+	up := &Updater{Arguments: Arguments{Track: UnstableTrack}}
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		for _, ver := range []string{"1.57.1", "1.59.3"} {
+			pkg, err := up.packagePath(ver)
+			if err != nil {
+				t.Errorf("packagePath: %v", err)
+			}
+			fmt.Fprintf(w, "<a href=%q>%s</a>\n", path.Base(pkg), path.Base(pkg))
+		}
+	}))
+	defer srv.Close()
+
+	got, err := ListVersions(Arguments{PkgsAddr: srv.URL, Track: UnstableTrack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/unstable/" {
+		t.Errorf("got request path %q, want %q", gotPath, "/unstable/")
+	}
+	if want := []string{"1.59.3", "1.57.1"}; !slices.Equal(got.Versions, want) {
+		t.Errorf("got versions %q, want %q", got.Versions, want)
+	}
+	if got.Track != UnstableTrack {
+		t.Errorf("got track %q, want %q", got.Track, UnstableTrack)
+	}
+}
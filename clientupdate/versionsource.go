@@ -0,0 +1,175 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"runtime"
+
+	"tailscale.com/version/distro"
+)
+
+// VersionSource looks up the latest released version of Tailscale.
+type VersionSource interface {
+	// Latest returns the latest release on track for goos and goarch. An
+	// empty track means CurrentTrack.
+	Latest(ctx context.Context, track, goos, goarch string) (*Release, error)
+}
+
+// PkgsVersionSource is a VersionSource that asks a pkgs server, like
+// pkgs.tailscale.com or a mirror of it.
+type PkgsVersionSource struct {
+	// Addr is the address of the pkgs server. Empty means the default,
+	// "https://pkgs.tailscale.com".
+	Addr string
+	// TLSConfig, if non-nil, is used for TLS connections to the server.
+	TLSConfig *tls.Config
+	// Proxy, if non-nil, is used instead of the proxy from the environment.
+	Proxy *url.URL
+	// SourceAddr, if valid, is the local address to connect from.
+	SourceAddr netip.Addr
+}
+
+func (s PkgsVersionSource) Latest(ctx context.Context, track, goos, goarch string) (*Release, error) {
+	if track == "" {
+		track = CurrentTrack
+	}
+
+	latest, err := latestPackagesForOS(ctx, s.Addr, s.TLSConfig, s.Proxy, s.SourceAddr, track, goos, goarch)
+	if err != nil {
+		return nil, err
+	}
+	ver := latest.versionForOS(goos)
+	if ver == "" {
+		return nil, fmt.Errorf("no latest version found for OS %q on %q track", goos, track)
+	}
+	return latest.release(ver, goos, goarch), nil
+}
+
+// versionForOS returns the latest version of the packages for goos in p.
+func (p *trackPackages) versionForOS(goos string) string {
+	switch goos {
+	case "windows":
+		return p.MSIsVersion
+	case "darwin":
+		return p.MacZipsVersion
+	case "linux":
+		if goos == runtime.GOOS && distro.Get() == distro.Synology {
+			return p.SPKsVersion
+		}
+		return p.TarballsVersion
+	}
+	return p.Version
+}
+
+// ManifestVersionSource is a VersionSource that reads a local JSON manifest
+// file instead of asking a pkgs server, for networks without access to one.
+// The manifest maps tracks to what a pkgs server returns for them with
+// "?mode=json", like:
+//
+//	{
+//		"stable": {
+//			"TarballsVersion": "1.70.0",
+//			"Tarballs": {"amd64": "tailscale_1.70.0_amd64.tgz"},
+//			"MSIsVersion": "1.70.0",
+//			"MSIs": {"amd64": "tailscale-setup-1.70.0-amd64.msi"}
+//		}
+//	}
+//
+// The manifest is read again for every lookup.
+type ManifestVersionSource struct {
+	// Path is the manifest file.
+	Path string
+}
+
+func (s ManifestVersionSource) Latest(ctx context.Context, track, goos, goarch string) (*Release, error) {
+	if track == "" {
+		track = CurrentTrack
+	}
+	tracks, err := readVersionManifest(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	latest, ok := tracks[track]
+	if !ok {
+		return nil, fmt.Errorf("version manifest %s has no %s track", s.Path, track)
+	}
+	ver := latest.versionForOS(goos)
+	if ver == "" {
+		return nil, fmt.Errorf("version manifest %s has no version for OS %q on the %s track", s.Path, goos, track)
+	}
+	// Packages are listed by architecture for the OSes that are updated
+	// with packages from the pkgs server, which are not for every one.
+	var pkgs map[string]string
+	arch := goarch
+	switch {
+	case goos == "windows":
+		pkgs, arch = latest.MSIs, msiArch(goarch)
+	case goos == "linux" && !(goos == runtime.GOOS && distro.Get() == distro.Synology):
+		pkgs = latest.Tarballs
+	}
+	if (goos == "windows" || pkgs != nil) && pkgs[arch] == "" {
+		return nil, fmt.Errorf("version manifest %s has no package for %s/%s on the %s track", s.Path, goos, goarch, track)
+	}
+	return latest.release(ver, goos, goarch), nil
+}
+
+// readVersionManifest reads and validates the version manifest at path, as
+// described in ManifestVersionSource.
+func readVersionManifest(path string) (map[string]*trackPackages, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading version manifest: %w", err)
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	// Catch misspelled fields, which would otherwise look like missing
+	// versions.
+	dec.DisallowUnknownFields()
+	var tracks map[string]*trackPackages
+	if err := dec.Decode(&tracks); err != nil {
+		return nil, fmt.Errorf("invalid version manifest %s: %w", path, err)
+	}
+	for track, p := range tracks {
+		if track != StableTrack && track != UnstableTrack {
+			return nil, fmt.Errorf("invalid version manifest %s: unknown track %q", path, track)
+		}
+		if p == nil {
+			return nil, fmt.Errorf("invalid version manifest %s: the %s track is null", path, track)
+		}
+		for _, v := range []string{p.Version, p.TarballsVersion, p.MSIsVersion, p.MacZipsVersion, p.SPKsVersion} {
+			if v == "" {
+				continue
+			}
+			if vt, err := versionToTrack(v); err != nil {
+				return nil, fmt.Errorf("invalid version manifest %s: %w", path, err)
+			} else if vt != track {
+				return nil, fmt.Errorf("invalid version manifest %s: version %s is not on the %s track", path, v, track)
+			}
+		}
+	}
+	return tracks, nil
+}
+
+// versionSource returns args.VersionSource, or a PkgsVersionSource for
+// args.PkgsAddr if it's nil.
+func (args Arguments) versionSource() VersionSource {
+	if args.VersionSource != nil {
+		return args.VersionSource
+	}
+	return PkgsVersionSource{Addr: args.PkgsAddr, TLSConfig: args.TLSConfig, Proxy: args.Proxy, SourceAddr: args.SourceAddr}
+}
+
+// latestRelease returns the latest release for this platform on up.Track.
+func (up *Updater) latestRelease() (*Release, error) {
+	ctx, cancel := up.context()
+	defer cancel()
+	return up.versionSource().Latest(ctx, up.Track, runtime.GOOS, up.arch())
+}
@@ -0,0 +1,313 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"tailscale.com/version/distro"
+)
+
+// fakeVersionSource is a VersionSource with fixed latest versions per track.
+type fakeVersionSource struct {
+	latest map[string]string // track => version
+	calls  int
+}
+
+func (s *fakeVersionSource) Latest(ctx context.Context, track, goos, goarch string) (*Release, error) {
+	s.calls++
+	if track == "" {
+		track = CurrentTrack
+	}
+	ver, ok := s.latest[track]
+	if !ok {
+		return nil, fmt.Errorf("no latest version found for OS %q on %q track", goos, track)
+	}
+	return &Release{Version: ver}, nil
+}
+
+func TestPkgsVersionSource(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		fmt.Fprint(w, `{"Version": "1.70.0", "TarballsVersion": "1.70.1", "MSIsVersion": "1.70.2", "MacZipsVersion": "1.70.3"}`)
+	}))
+	defer srv.Close()
+
+	src := PkgsVersionSource{Addr: srv.URL}
+	for _, tt := range []struct {
+		goos, goarch string
+		want         string
+		wantArch     string // in the query
+	}{
+		{goos: "freebsd", goarch: "amd64", want: "1.70.0", wantArch: "amd64"},
+		{goos: "linux", goarch: "386", want: "1.70.1", wantArch: "x86"},
+		{goos: "windows", goarch: "386", want: "1.70.2", wantArch: "x86"},
+		{goos: "windows", goarch: "arm64", want: "1.70.2", wantArch: "arm64"},
+		{goos: "darwin", goarch: "arm64", want: "1.70.3", wantArch: "arm64"},
+	} {
+		t.Run(tt.goos+"/"+tt.goarch, func(t *testing.T) {
+			if tt.goos == runtime.GOOS && distro.Get() == distro.Synology {
+				t.Skip("Synology uses SPKsVersion")
+			}
+			rel, err := src.Latest(context.Background(), StableTrack, tt.goos, tt.goarch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel.Version != tt.want {
+				t.Errorf("got %q, want %q", rel.Version, tt.want)
+			}
+			if want := "mode=json&os=" + tt.goos + "&arch=" + tt.wantArch; gotQuery != want {
+				t.Errorf("got query %q, want %q", gotQuery, want)
+			}
+		})
+	}
+}
+
+func TestManifestVersionSource(t *testing.T) {
+	writeManifest := func(t *testing.T, manifest string) string {
+		path := filepath.Join(t.TempDir(), "manifest.json")
+		if err := os.WriteFile(path, []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	const manifest = `{
+		"stable": {
+			"Version": "1.70.0",
+			"TarballsVersion": "1.70.1",
+			"Tarballs": {"amd64": "tailscale_1.70.1_amd64.tgz"},
+			"MSIsVersion": "1.70.2",
+			"MSIs": {"amd64": "tailscale-setup-1.70.2-amd64.msi", "x86": "tailscale-setup-1.70.2-x86.msi"},
+			"MacZipsVersion": "1.70.3"
+		}
+	}`
+	src := ManifestVersionSource{Path: writeManifest(t, manifest)}
+	for _, tt := range []struct {
+		track, goos, goarch string
+		want                string
+		wantErr             string
+	}{
+		{track: StableTrack, goos: "freebsd", goarch: "amd64", want: "1.70.0"},
+		{track: StableTrack, goos: "linux", goarch: "amd64", want: "1.70.1"},
+		{track: StableTrack, goos: "windows", goarch: "386", want: "1.70.2"},
+		{track: StableTrack, goos: "darwin", goarch: "arm64", want: "1.70.3"},
+		{track: StableTrack, goos: "linux", goarch: "arm64", wantErr: "no package for linux/arm64"},
+		{track: StableTrack, goos: "windows", goarch: "arm64", wantErr: "no package for windows/arm64"},
+		{track: UnstableTrack, goos: "linux", goarch: "amd64", wantErr: "has no unstable track"},
+	} {
+		t.Run(tt.track+"/"+tt.goos+"/"+tt.goarch, func(t *testing.T) {
+			if tt.goos == runtime.GOOS && distro.Get() == distro.Synology {
+				t.Skip("Synology uses SPKsVersion")
+			}
+			rel, err := src.Latest(context.Background(), tt.track, tt.goos, tt.goarch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel.Version != tt.want {
+				t.Errorf("got %q, want %q", rel.Version, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name     string
+		manifest string
+		wantErr  string
+	}{
+		{"not-json", `stable: 1.70.0`, "invalid version manifest"},
+		{"unknown-field", `{"stable": {"TarballVersion": "1.70.0"}}`, "unknown field"},
+		{"unknown-track", `{"beta": {"Version": "1.70.0"}}`, `unknown track "beta"`},
+		{"malformed-version", `{"stable": {"TarballsVersion": "latest"}}`, "malformed version"},
+		{"wrong-track", `{"stable": {"Version": "1.71.5"}}`, "not on the stable track"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			src := ManifestVersionSource{Path: writeManifest(t, tt.manifest)}
+			_, err := src.Latest(context.Background(), StableTrack, "linux", "amd64")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVersionSourceOverride(t *testing.T) {
+	src := &fakeVersionSource{latest: map[string]string{StableTrack: "1.70.0"}}
+	args := Arguments{
+		Track:         StableTrack,
+		VersionSource: src,
+		// Fail any request that reaches the network.
+		PkgsAddr: "http://127.0.0.1:1",
+	}
+
+	res, err := checkForUpdate(args, "1.68.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.UpdateAvailable || res.Latest != "1.70.0" {
+		t.Errorf("checkForUpdate: got %+v, want update to 1.70.0", res)
+	}
+
+	var confirmed string
+	up := &Updater{
+		Arguments:      args,
+		currentVersion: "1.68.2",
+	}
+	up.Confirm = func(ver string) bool {
+		confirmed = ver
+		return false
+	}
+	up.Logf = t.Logf
+	ver, err := up.requestedTailscaleVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver != "1.70.0" {
+		t.Errorf("requestedTailscaleVersion: got %q, want 1.70.0", ver)
+	}
+	if up.confirm(ver) {
+		t.Error("confirm: got true, want false")
+	}
+	if confirmed != "1.70.0" {
+		t.Errorf("Confirm called with %q, want 1.70.0", confirmed)
+	}
+	if src.calls != 2 {
+		t.Errorf("got %d lookups, want 2", src.calls)
+	}
+
+	up.Track = UnstableTrack
+	if _, err := up.requestedTailscaleVersion(); err == nil {
+		t.Error("requestedTailscaleVersion on a track without versions: got nil error")
+	}
+}
+
+func TestVersionKeywords(t *testing.T) {
+	src := &fakeVersionSource{latest: map[string]string{
+		CurrentTrack:  "1.70.0",
+		StableTrack:   "1.70.0",
+		UnstableTrack: "1.71.5",
+	}}
+	check := func(ver, track string) *CheckResult {
+		t.Helper()
+		args := Arguments{
+			Version:       ver,
+			Track:         track,
+			VersionSource: src,
+			PkgsAddr:      "http://127.0.0.1:1",
+		}
+		res, err := checkForUpdate(args, "1.68.2")
+		if err != nil {
+			t.Fatalf("checkForUpdate(Version=%q, Track=%q): %v", ver, track, err)
+		}
+		return res
+	}
+	tests := []struct {
+		keyword string
+		track   string // the track it's the same as
+	}{
+		{"latest", ""},
+		{"stable", StableTrack},
+		{"unstable", UnstableTrack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyword, func(t *testing.T) {
+			got, want := check(tt.keyword, ""), check("", tt.track)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Version %q: got %+v, want %+v", tt.keyword, got, want)
+			}
+		})
+	}
+
+	// Other versions are still taken literally.
+	if res := check("1.66.0", ""); res.Latest != "1.66.0" || res.Track != StableTrack {
+		t.Errorf("Version 1.66.0: got %+v", res)
+	}
+}
+
+func TestCheckForUpdateAllowPrerelease(t *testing.T) {
+	args := Arguments{
+		AllowPrerelease: true,
+		VersionSource: &fakeVersionSource{latest: map[string]string{
+			StableTrack:   "1.70.0",
+			UnstableTrack: "1.71.3",
+		}},
+	}
+	res, err := checkForUpdate(args, "1.70.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Track != UnstableTrack || res.Latest != "1.71.3" || !res.UpdateAvailable {
+		t.Errorf("got %+v, want update to 1.71.3 on the unstable track", res)
+	}
+}
+
+func TestNormalizeTrack(t *testing.T) {
+	src := &fakeVersionSource{latest: map[string]string{
+		StableTrack:   "1.70.0",
+		UnstableTrack: "1.71.5",
+	}}
+	tests := []struct {
+		track   string
+		want    string
+		wantErr string
+	}{
+		{track: "Stable", want: StableTrack},
+		{track: "UNSTABLE", want: UnstableTrack},
+		{track: " stable ", want: StableTrack},
+		{track: "unstable\n", want: UnstableTrack},
+		// The track of this build, like leaving Track empty.
+		{track: "current", want: CurrentTrack},
+		{track: " Current ", want: CurrentTrack},
+		{track: "beta", wantErr: `unsupported track "beta"; must be "stable" or "unstable"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.track, func(t *testing.T) {
+			args := Arguments{
+				Track:         tt.track,
+				VersionSource: src,
+				PkgsAddr:      "http://127.0.0.1:1",
+				Confirm:       func(string) bool { return false },
+				Logf:          t.Logf,
+			}
+			err := args.validate()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("validate: got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			res, err := checkForUpdate(args, "1.68.2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Track != tt.want || res.Latest != src.latest[tt.want] {
+				t.Errorf("checkForUpdate: got track %q, latest %q; want %q, %q", res.Track, res.Latest, tt.want, src.latest[tt.want])
+			}
+		})
+	}
+
+	// Like no track, "current" can be combined with a version.
+	args := Arguments{Track: "current", Version: "1.70.0", Confirm: func(string) bool { return false }, Logf: t.Logf}
+	if err := args.validate(); err != nil {
+		t.Errorf("validate with Version and current Track: %v", err)
+	}
+}
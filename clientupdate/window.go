@@ -0,0 +1,66 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a daily time range during which updates may be
+// applied. Start and End are offsets from local midnight. If End is before
+// Start, the window wraps around midnight.
+type MaintenanceWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseMaintenanceWindow parses a window in the form "HH:MM-HH:MM", such as
+// "02:00-04:00" or "23:00-01:00".
+func ParseMaintenanceWindow(s string) (MaintenanceWindow, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: want HH:MM-HH:MM", s)
+	}
+	var w MaintenanceWindow
+	var err error
+	if w.Start, err = parseTimeOfDay(start); err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	if w.End, err = parseTimeOfDay(end); err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	if w.Start == w.End {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: start and end are the same", s)
+	}
+	return w, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls within w, using the time of day of t in
+// its own location. The start of the window is inclusive and the end is
+// exclusive.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	h, m, sec := t.Clock()
+	sinceMidnight := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	if w.Start < w.End {
+		return sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+	// Window wraps around midnight.
+	return sinceMidnight >= w.Start || sinceMidnight < w.End
+}
+
+func (w MaintenanceWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d",
+		int(w.Start.Hours()), int(w.Start.Minutes())%60,
+		int(w.End.Hours()), int(w.End.Minutes())%60)
+}
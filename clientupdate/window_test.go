@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "02:00-04:00", want: "02:00-04:00"},
+		{in: "23:30 - 01:15", want: "23:30-01:15"},
+		{in: "2:00-4:00", want: "02:00-04:00"},
+		{in: "02:00", wantErr: true},
+		{in: "02:00-02:00", wantErr: true},
+		{in: "25:00-04:00", wantErr: true},
+		{in: "02:00-noon", wantErr: true},
+	}
+	for _, tt := range tests {
+		w, err := ParseMaintenanceWindow(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMaintenanceWindow(%q) = %v, want error", tt.in, w)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMaintenanceWindow(%q): %v", tt.in, err)
+			continue
+		}
+		if got := w.String(); got != tt.want {
+			t.Errorf("ParseMaintenanceWindow(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
+	at := func(loc *time.Location, hour, min int) time.Time {
+		return time.Date(2024, 1, 15, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name   string
+		window string
+		t      time.Time
+		want   bool
+	}{
+		{"before", "02:00-04:00", at(time.UTC, 1, 59), false},
+		{"start-inclusive", "02:00-04:00", at(time.UTC, 2, 0), true},
+		{"inside", "02:00-04:00", at(time.UTC, 3, 30), true},
+		{"end-exclusive", "02:00-04:00", at(time.UTC, 4, 0), false},
+		{"wrap-before-midnight", "23:00-01:00", at(time.UTC, 23, 30), true},
+		{"wrap-after-midnight", "23:00-01:00", at(time.UTC, 0, 30), true},
+		{"wrap-outside", "23:00-01:00", at(time.UTC, 12, 0), false},
+		{"wrap-end-exclusive", "23:00-01:00", at(time.UTC, 1, 0), false},
+		// The same instant is inside the window in one timezone and
+		// outside of it in another.
+		{"tokyo-inside", "02:00-04:00", at(time.UTC, 18, 0).In(tokyo), true},
+		{"new-york-outside", "02:00-04:00", at(time.UTC, 18, 0).In(newYork), false},
+		{"new-york-wrap-outside", "23:00-01:00", at(time.UTC, 6, 30).In(newYork), false},
+		{"new-york-wrap-inside", "23:00-01:00", at(time.UTC, 4, 30).In(newYork), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseMaintenanceWindow(tt.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Contains(tt.t); got != tt.want {
+				t.Errorf("%v.Contains(%v) = %v, want %v", w, tt.t, got, tt.want)
+			}
+		})
+	}
+}
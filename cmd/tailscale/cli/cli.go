@@ -32,6 +32,7 @@
 
 var Stderr io.Writer = os.Stderr
 var Stdout io.Writer = os.Stdout
+var Stdin io.Reader = os.Stdin
 
 func errf(format string, a ...any) {
 	fmt.Fprintf(Stderr, format, a...)
@@ -6,18 +6,26 @@
 import (
 	"bytes"
 	stdcmp "cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/netip"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 	"github.com/google/go-cmp/cmp"
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/clientupdate"
 	"tailscale.com/envknob"
 	"tailscale.com/health/healthmsg"
 	"tailscale.com/ipn"
@@ -31,6 +39,7 @@
 	"tailscale.com/types/persist"
 	"tailscale.com/types/preftype"
 	"tailscale.com/util/set"
+	"tailscale.com/version"
 	"tailscale.com/version/distro"
 )
 
@@ -1499,6 +1508,946 @@ func TestParseNLArgs(t *testing.T) {
 	}
 }
 
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "", want: 0},
+		{in: "500000", want: 500000},
+		{in: "512K", want: 512 << 10},
+		{in: "1M", want: 1 << 20},
+		{in: "2g", want: 2 << 30},
+		{in: "0", wantErr: true},
+		{in: "-1M", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "1.5M", wantErr: true},
+		{in: "1MB", wantErr: true},
+		{in: "9999999999999G", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteRate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseByteRate(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseByteRate(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVersionsMismatch(t *testing.T) {
+	tests := []struct {
+		client, daemon string
+		want           bool
+	}{
+		{"1.56.0", "1.56.0", false},
+		{"1.56.0", "1.56.0-t0123456789-g0123456789", false},
+		{"1.56.1", "1.56.0-t0123456789-g0123456789", false}, // patch only
+		{"1.56.0", "1.54.2", true},
+		{"1.56.0-t0123456789", "1.55.1-t0123456789-g0123456789", true},
+		{"2.0.0", "1.0.0", true},
+	}
+	for _, tt := range tests {
+		if got := versionsMismatch(tt.client, tt.daemon); got != tt.want {
+			t.Errorf("versionsMismatch(%q, %q) = %v; want %v", tt.client, tt.daemon, got, tt.want)
+		}
+	}
+}
+
+func TestVersionUpstreamTrackNormalized(t *testing.T) {
+	tstest.Replace(t, &versionArgs.upstream, false)
+	for _, track := range []string{"Stable", "UNSTABLE", " stable "} {
+		tstest.Replace(t, &versionArgs.upstreamTrack, track)
+		if err := runVersion(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "requires --upstream") {
+			t.Errorf("--upstream-track=%q: got error %v; want it accepted and to require --upstream", track, err)
+		}
+	}
+	tstest.Replace(t, &versionArgs.upstreamTrack, "beta")
+	if err := runVersion(context.Background(), nil); err == nil || !strings.Contains(err.Error(), `invalid --upstream-track "beta"`) {
+		t.Errorf(`--upstream-track=beta: got error %v; want it rejected`, err)
+	}
+}
+
+func TestVersionRelation(t *testing.T) {
+	tests := []struct {
+		v, other string
+		want     string
+	}{
+		{"1.56.0", "1.56.0", "same"},
+		{"1.56.0-t0123456789-g0123456789", "1.56.0", "same"},
+		{"1.56.0", "v1.56.0", "same"},
+		{"1.54.2", "1.56.0", "older"},
+		{"1.55.1-t0123456789-g0123456789", "1.56.0", "older"},
+		{"1.56.0", "1.56.10", "older"},
+		{"1.56.1", "1.56.0", "newer"},
+		{"1.57.0-t0123456789", "1.56.0+build7", "newer"},
+		{"2.0.0", "1.99.99", "newer"},
+		{"1.56.0", "1.56", "same"},
+		{"1.56.2", "1.56", "newer"},
+	}
+	for _, tt := range tests {
+		if got := versionRelation(tt.v, tt.other); got != tt.want {
+			t.Errorf("versionRelation(%q, %q) = %q; want %q", tt.v, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestRunVersionCompare(t *testing.T) {
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+	tstest.Replace(t, &versionArgs.compare, version.Short())
+	if err := runVersion(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "same\n" {
+		t.Errorf("output = %q; want %q", got, "same\n")
+	}
+
+	for _, bad := range []string{"latest", "1", "1.x.0"} {
+		versionArgs.compare = bad
+		if err := runVersion(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "invalid --compare") {
+			t.Errorf("--compare=%s: got error %v; want invalid version", bad, err)
+		}
+	}
+
+	versionArgs.compare = ""
+	tstest.Replace(t, &versionArgs.compareExitCode, true)
+	if err := runVersion(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "requires --compare") {
+		t.Errorf("--compare-exit-code alone: got error %v; want it to require --compare", err)
+	}
+}
+
+func TestReleaseDetails(t *testing.T) {
+	tests := []struct {
+		rel   clientupdate.Release
+		track string
+		want  string
+	}{
+		{clientupdate.Release{Version: "1.70.0"}, "", ""},
+		{clientupdate.Release{Version: "1.70.0", Date: time.Date(2024, 7, 22, 15, 4, 5, 0, time.UTC)}, "", " (released 2024-07-22)"},
+		{clientupdate.Release{Version: "1.70.0", SHA256: "abcd"}, "", " (sha256 abcd)"},
+		{clientupdate.Release{Version: "1.70.0", Date: time.Date(2024, 7, 22, 0, 0, 0, 0, time.UTC), SHA256: "abcd"}, "", " (released 2024-07-22, sha256 abcd)"},
+		{clientupdate.Release{Version: "1.71.1"}, "unstable", " (unstable track)"},
+		{clientupdate.Release{Version: "1.71.1", SHA256: "abcd"}, "unstable", " (unstable track, sha256 abcd)"},
+	}
+	for _, tt := range tests {
+		if got := releaseDetails(&tt.rel, tt.track); got != tt.want {
+			t.Errorf("releaseDetails(%+v, %q) = %q; want %q", tt.rel, tt.track, got, tt.want)
+		}
+	}
+}
+
+func TestPrintUpdateJSON(t *testing.T) {
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+	if err := printUpdateJSON(&updateJSON{Current: "1.70.0", Latest: "1.72.0"}); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["schemaVersion"] != float64(updateJSONSchemaVersion) {
+		t.Errorf("got schemaVersion %v, want %d, in:\n%s", got["schemaVersion"], updateJSONSchemaVersion, stdout.Bytes())
+	}
+}
+
+func TestUpdateJSONSchema(t *testing.T) {
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+	tstest.Replace(t, &updateArgs.jsonSchema, true)
+	if err := runUpdate(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	autoUpdate := true
+	samples := []any{
+		&updateJSON{SchemaVersion: updateJSONSchemaVersion, Current: "1.70.0", Latest: "1.72.0", Track: "stable", Platform: "linux/amd64", Result: "applied", ToVersion: "1.72.0"},
+		&updateListJSON{SchemaVersion: updateJSONSchemaVersion, Current: "1.70.0", Track: "stable", Platform: "linux/amd64", Versions: []string{"1.72.0", "1.70.0"}},
+		&updateStatusJSON{SchemaVersion: updateJSONSchemaVersion, Current: "1.70.0", Track: "stable", InstallMethod: "apt", AutoUpdate: &autoUpdate},
+	}
+	for _, sample := range samples {
+		j, err := json.Marshal(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v any
+		if err := json.Unmarshal(j, &v); err != nil {
+			t.Fatal(err)
+		}
+		if err := validateJSONSchema(schema, schema, v); err != nil {
+			t.Errorf("%s does not match the schema: %v", j, err)
+		}
+	}
+
+	// And something that isn't any of them.
+	bad := map[string]any{"schemaVersion": float64(updateJSONSchemaVersion), "current": 1.7}
+	if err := validateJSONSchema(schema, schema, bad); err == nil {
+		t.Errorf("%v matches the schema; want error", bad)
+	}
+}
+
+// validateJSONSchema reports whether v, as decoded by encoding/json, matches
+// schema, for the subset of JSON Schema that updateJSONSchema uses. $refs are
+// resolved in root.
+func validateJSONSchema(root, schema map[string]any, v any) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name, ok := strings.CutPrefix(ref, "#/$defs/")
+		if !ok {
+			return fmt.Errorf("unsupported $ref %q", ref)
+		}
+		def, ok := root["$defs"].(map[string]any)[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("undefined $ref %q", ref)
+		}
+		return validateJSONSchema(root, def, v)
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, s := range anyOf {
+			if validateJSONSchema(root, s.(map[string]any), v) == nil {
+				return nil
+			}
+		}
+		return errors.New("matches none of anyOf")
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, v) {
+		return fmt.Errorf("got %v, want %v", v, c)
+	}
+	switch schema["type"] {
+	case nil:
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("got %v, want a boolean", v)
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != float64(int64(f)) {
+			return fmt.Errorf("got %v, want an integer", v)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("got %v, want a string", v)
+		}
+	case "array":
+		a, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("got %v, want an array", v)
+		}
+		for _, e := range a {
+			if err := validateJSONSchema(root, schema["items"].(map[string]any), e); err != nil {
+				return err
+			}
+		}
+	case "object":
+		o, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("got %v, want an object", v)
+		}
+		for _, k := range schema["required"].([]any) {
+			if _, ok := o[k.(string)]; !ok {
+				return fmt.Errorf("missing required %q", k)
+			}
+		}
+		props := schema["properties"].(map[string]any)
+		for k, e := range o {
+			if p, ok := props[k]; ok {
+				if err := validateJSONSchema(root, p.(map[string]any), e); err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %v", schema["type"])
+	}
+	return nil
+}
+
+func TestRunVersionOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientOnly bool
+		daemonOnly bool
+		verbose    bool
+		json       bool
+		want       string
+		wantErr    bool
+	}{
+		{name: "client", clientOnly: true, want: version.Long() + "\n"},
+		{name: "client-json", clientOnly: true, json: true, want: "{\n\t\"schemaVersion\": 1,\n\t\"long\": \"" + version.Long() + "\"\n}\n"},
+		{name: "both", clientOnly: true, daemonOnly: true, wantErr: true},
+		{name: "verbose", clientOnly: true, verbose: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			tstest.Replace[io.Writer](t, &Stdout, &stdout)
+			tstest.Replace(t, &versionArgs.clientOnly, tt.clientOnly)
+			tstest.Replace(t, &versionArgs.daemonOnly, tt.daemonOnly)
+			tstest.Replace(t, &versionArgs.verbose, tt.verbose)
+			tstest.Replace(t, &versionArgs.json, tt.json)
+			err := runVersion(context.Background(), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error: %v", err, tt.wantErr)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("got output %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunVersionDaemonDown(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on connecting to tailscaled over a unix socket")
+	}
+	tstest.Replace(t, &localClient.Socket, filepath.Join(t.TempDir(), "tailscaled.sock"))
+	tstest.Replace(t, &versionArgs.daemon, true)
+
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+	if err := runVersion(context.Background(), nil); err != nil {
+		t.Fatalf("runVersion: %v", err)
+	}
+	want := "Client: " + version.String() + "\nDaemon: not running (could not connect to tailscaled)\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("got output %q; want %q", got, want)
+	}
+
+	stdout.Reset()
+	tstest.Replace(t, &versionArgs.json, true)
+	if err := runVersion(context.Background(), nil); err != nil {
+		t.Fatalf("runVersion --json: %v", err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["daemonRunning"] != false {
+		t.Errorf("daemonRunning = %v; want false", out["daemonRunning"])
+	}
+	if v, ok := out["daemonLong"]; ok {
+		t.Errorf("daemonLong = %v; want it omitted", v)
+	}
+
+	tstest.Replace(t, &versionArgs.daemon, false)
+	tstest.Replace(t, &versionArgs.json, false)
+	tstest.Replace(t, &versionArgs.daemonOnly, true)
+	if err := runVersion(context.Background(), nil); err == nil {
+		t.Error("runVersion --daemon-only succeeded; want error")
+	}
+}
+
+func TestDaemonUpgradeCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		cv          *tailcfg.ClientVersion
+		wantLatest  string // empty means a nil result
+		wantUpgrade bool
+	}{
+		{name: "no-client-version"},
+		{name: "unknown", cv: &tailcfg.ClientVersion{}},
+		{name: "daemon-latest", cv: &tailcfg.ClientVersion{RunningLatest: true}, wantLatest: "1.72.0"},
+		{name: "newer", cv: &tailcfg.ClientVersion{LatestVersion: "1.74.0"}, wantLatest: "1.74.0", wantUpgrade: true},
+		{name: "older", cv: &tailcfg.ClientVersion{LatestVersion: "1.70.0"}, wantLatest: "1.70.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &ipnstate.Status{Version: "1.72.0-t1234abcd-g5678ef", ClientVersion: tt.cv}
+			got := daemonUpgradeCheck("1.72.0", st)
+			if tt.wantLatest == "" {
+				if got != nil {
+					t.Errorf("got %+v; want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("got nil")
+			}
+			if got.Latest != tt.wantLatest || got.UpdateAvailable != tt.wantUpgrade || got.Current != "1.72.0" {
+				t.Errorf("got %+v; want Latest %q, UpdateAvailable %v", got, tt.wantLatest, tt.wantUpgrade)
+			}
+		})
+	}
+}
+
+func TestIsTailscaledConnectError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "unix", Err: errors.New("connection refused")}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("500 Internal Server Error"), false},
+		{dialErr, true},
+		{fmt.Errorf("Failed to connect to local Tailscale daemon; Error: %w", dialErr), true},
+		{&net.OpError{Op: "read", Net: "unix", Err: errors.New("reset")}, false},
+	}
+	for _, tt := range tests {
+		if got := isTailscaledConnectError(tt.err); got != tt.want {
+			t.Errorf("isTailscaledConnectError(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestGetAutoUpdateStatus(t *testing.T) {
+	tests := []struct {
+		prefs ipn.AutoUpdatePrefs
+		want  autoUpdateStatus
+	}{
+		{ipn.AutoUpdatePrefs{}, autoUpdateStatus{}},
+		{ipn.AutoUpdatePrefs{Check: true, Apply: "unset"}, autoUpdateStatus{Check: true}},
+		{ipn.AutoUpdatePrefs{Check: true, Apply: "false"}, autoUpdateStatus{Check: true}},
+		{ipn.AutoUpdatePrefs{Check: true, Apply: "true"}, autoUpdateStatus{Enabled: true, Check: true}},
+	}
+	for _, tt := range tests {
+		if got := getAutoUpdateStatus(tt.prefs); *got != tt.want {
+			t.Errorf("getAutoUpdateStatus(%+v) = %+v; want %+v", tt.prefs, *got, tt.want)
+		}
+	}
+}
+
+func TestAutoUpdateUnits(t *testing.T) {
+	service, timer := autoUpdateUnits("/usr/bin/tailscale", 3, 7)
+	if !strings.Contains(service, "\nExecStart=/usr/bin/tailscale update --yes --track=stable\n") {
+		t.Errorf("service unit has no ExecStart for tailscale update:\n%s", service)
+	}
+	if !strings.Contains(timer, "\nOnCalendar=*-*-* 03:07:00\n") {
+		t.Errorf("timer unit does not run at 03:07:\n%s", timer)
+	}
+}
+
+func TestUnattendedUpgradesEnabled(t *testing.T) {
+	tests := []struct {
+		conf string
+		want bool
+	}{
+		{"", false},
+		{"APT::Periodic::Update-Package-Lists \"1\";\nAPT::Periodic::Unattended-Upgrade \"1\";\n", true},
+		{"APT::Periodic::Unattended-Upgrade \"0\";\n", false},
+		{"APT::Periodic::Unattended-Upgrade \"1\";\nAPT::Periodic::Unattended-Upgrade \"0\";\n", false},
+		{"// APT::Periodic::Unattended-Upgrade \"1\";\n", false},
+	}
+	for _, tt := range tests {
+		if got := unattendedUpgradesEnabled([]byte(tt.conf)); got != tt.want {
+			t.Errorf("unattendedUpgradesEnabled(%q) = %v; want %v", tt.conf, got, tt.want)
+		}
+	}
+}
+
+func TestUnattendedUpgradesCoverTailscale(t *testing.T) {
+	const debianDefault = `Unattended-Upgrade::Origins-Pattern {
+        // "origin=Tailscale";
+        "origin=Debian,codename=${distro_codename},label=Debian";
+        "origin=Debian,codename=${distro_codename},label=Debian-Security";
+};
+`
+	tests := []struct {
+		name string
+		conf string
+		want bool
+	}{
+		{"none", "", false},
+		{"debian-default", debianDefault, false},
+		{"ubuntu-default", "Unattended-Upgrade::Allowed-Origins {\n\t\"${distro_id}:${distro_codename}\";\n\t\"${distro_id}ESMApps:${distro_codename}-apps-security\";\n};\n", false},
+		{"origin", debianDefault + "Unattended-Upgrade::Origins-Pattern {\n\t\"origin=Tailscale\";\n};\n", true},
+		{"single-value", "Unattended-Upgrade::Origins-Pattern:: \"o=Tailscale,l=Tailscale\";\n", true},
+		{"site", "Unattended-Upgrade::Origins-Pattern { \"site=pkgs.tailscale.com\"; };\n", true},
+		{"other-site", "Unattended-Upgrade::Origins-Pattern { \"site=deb.debian.org\"; };\n", false},
+		{"wildcard", "Unattended-Upgrade::Origins-Pattern { \"origin=*\"; };\n", true},
+		{"allowed-origins", "Unattended-Upgrade::Allowed-Origins { \"Tailscale:stable\"; };\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unattendedUpgradesCoverTailscale([][]byte{[]byte(tt.conf)}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForDaemonVersion(t *testing.T) {
+	ctx := context.Background()
+	versions := func(vs ...string) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) {
+			v := vs[0]
+			if len(vs) > 1 {
+				vs = vs[1:]
+			}
+			return v, nil
+		}
+	}
+
+	got, err := waitForDaemonVersion(ctx, "1.58.2", time.Second, versions("1.58.0-t1", "1.58.2-t2-g3"))
+	if got != "" || err != nil {
+		t.Errorf("after restart: got %q, %v; want success", got, err)
+	}
+	got, err = waitForDaemonVersion(ctx, "1.58.2", 10*time.Millisecond, versions("1.58.0-t1"))
+	if got != "1.58.0-t1" || err != nil {
+		t.Errorf("without restart: got %q, %v; want old version", got, err)
+	}
+	wantErr := errors.New("connection refused")
+	_, err = waitForDaemonVersion(ctx, "1.58.2", 10*time.Millisecond, func(context.Context) (string, error) { return "", wantErr })
+	if err != wantErr {
+		t.Errorf("daemon down: got error %v, want %v", err, wantErr)
+	}
+}
+
+func TestConfirmUpdateNoTerminal(t *testing.T) {
+	tstest.Replace[io.Reader](t, &Stdin, strings.NewReader(""))
+	tstest.Replace(t, &updateArgs.yes, false)
+	tstest.Replace(t, &updateArgs.dryRun, false)
+
+	// Without a terminal, fail instead of waiting for an answer.
+	if ok, err := confirmUpdate("1.58.2"); ok || err != errNoTerminal {
+		t.Errorf("got %v, %v; want false, %v", ok, err, errNoTerminal)
+	}
+
+	// --yes doesn't need to prompt.
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+	updateArgs.yes = true
+	if ok, err := confirmUpdate("1.58.2"); !ok || err != nil {
+		t.Errorf("with --yes: got %v, %v; want true, nil", ok, err)
+	}
+	if stdout.Len() == 0 {
+		t.Error("with --yes: nothing printed")
+	}
+
+	// --quiet keeps it from saying so.
+	stdout.Reset()
+	tstest.Replace(t, &updateArgs.quiet, true)
+	if ok, err := confirmUpdate("1.58.2"); !ok || err != nil {
+		t.Errorf("with --yes --quiet: got %v, %v; want true, nil", ok, err)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("with --yes --quiet: printed %q", stdout.String())
+	}
+}
+
+func TestConfirmUpdateDowngrade(t *testing.T) {
+	tstest.Replace(t, &updateArgs.yes, true)
+	tstest.Replace(t, &updateArgs.quiet, false)
+	tests := []struct {
+		ver       string
+		reinstall bool
+		want      string
+	}{
+		{"999.0.0", false, "Updating Tailscale from "},
+		{"1.0.0", false, "Downgrading Tailscale from "},
+		{version.Short(), true, "Reinstalling Tailscale " + version.Short() + ";"},
+	}
+	for _, tt := range tests {
+		var stdout bytes.Buffer
+		tstest.Replace[io.Writer](t, &Stdout, &stdout)
+		tstest.Replace(t, &updateArgs.reinstall, tt.reinstall)
+		if ok, err := confirmUpdate(tt.ver); !ok || err != nil {
+			t.Errorf("confirmUpdate(%q) = %v, %v; want true, nil", tt.ver, ok, err)
+		}
+		if !strings.HasPrefix(stdout.String(), tt.want) {
+			t.Errorf("confirmUpdate(%q) printed %q; want prefix %q", tt.ver, stdout.String(), tt.want)
+		}
+	}
+}
+
+func TestCheckOnlyIfNewer(t *testing.T) {
+	tstest.Replace(t, &updateArgs.onlyIfNewer, true)
+	tstest.Replace(t, &updateArgs.allowDowngrade, false)
+	for _, ver := range []string{"1.0.0", version.Short()} {
+		err := checkOnlyIfNewer(ver)
+		if err == nil || !strings.Contains(err.Error(), "is not newer than current") {
+			t.Errorf("checkOnlyIfNewer(%q) = %v; want a refusal", ver, err)
+		}
+	}
+	if err := checkOnlyIfNewer("999.0.0"); err != nil {
+		t.Errorf("checkOnlyIfNewer(999.0.0) = %v; want nil", err)
+	}
+	updateArgs.allowDowngrade = true
+	if err := checkOnlyIfNewer("1.0.0"); err != nil {
+		t.Errorf("checkOnlyIfNewer(1.0.0) with --allow-downgrade = %v; want nil", err)
+	}
+}
+
+func TestUpdateCheckExitCode(t *testing.T) {
+	tests := []struct {
+		available  bool
+		json       bool
+		strictExit bool
+		want       int
+	}{
+		{available: false, want: 0},
+		{available: true, want: 2},
+		{available: false, json: true, want: 0},
+		{available: true, json: true, want: 0},
+		{available: false, json: true, strictExit: true, want: 0},
+		{available: true, json: true, strictExit: true, want: 2},
+	}
+	for _, tt := range tests {
+		res := &clientupdate.CheckResult{UpdateAvailable: tt.available}
+		if got := updateCheckExitCode(res, tt.json, tt.strictExit); got != tt.want {
+			t.Errorf("updateCheckExitCode(available=%v, json=%v, strictExit=%v) = %d; want %d", tt.available, tt.json, tt.strictExit, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateUnattended(t *testing.T) {
+	tstest.Replace(t, &updateArgs.unattended, true)
+	tstest.Replace(t, &updateArgs.yes, false)
+	tstest.Replace(t, &updateArgs.quiet, false)
+	tstest.Replace(t, &updateArgs.dryRun, false)
+
+	// Flags that don't install anything fail, for exit status 1.
+	tstest.Replace(t, &updateArgs.check, true)
+	if err := runUpdate(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "--unattended") {
+		t.Errorf("--unattended --check: got error %v; want one about --unattended", err)
+	}
+	updateArgs.check = false
+
+	// It neither prompts nor says that it isn't prompting.
+	tstest.Replace[io.Reader](t, &Stdin, strings.NewReader(""))
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+	updateArgs.yes = true // as set by runUpdate
+	if ok, err := confirmUpdate("999.0.0"); !ok || err != nil {
+		t.Errorf("confirmUpdate = %v, %v; want true, nil", ok, err)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("confirmUpdate printed %q", stdout.String())
+	}
+
+	err := unattendedTrackSwitchError(clientupdate.StableTrack, clientupdate.UnstableTrack)
+	if want := "--track=unstable"; !strings.Contains(err.Error(), want) {
+		t.Errorf("track switch error %q doesn't suggest %q", err, want)
+	}
+
+	// A declined track switch fails the update, even if the updater
+	// carries on regardless, without running --after-update.
+	tstest.Replace(t, &containerReason, func() string { return "" })
+	tstest.Replace(t, &runClientUpdate, func(args clientupdate.Arguments) error {
+		if args.Confirm("999.0.0") && !args.ConfirmTrackSwitch(clientupdate.StableTrack, clientupdate.UnstableTrack) {
+			return nil
+		}
+		return errors.New("track switch not declined")
+	})
+	if runtime.GOOS != "windows" {
+		marker := filepath.Join(t.TempDir(), "ran")
+		tstest.Replace(t, &updateArgs.afterUpdate, "touch "+marker)
+		stdout.Reset()
+		if err := runUpdate(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "--track=unstable") {
+			t.Errorf("track switch: got error %v; want the --unattended one", err)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Error("--after-update ran after a declined track switch")
+		}
+		if strings.Contains(stdout.String(), "Updated Tailscale") {
+			t.Errorf("reported success after a declined track switch: %q", stdout.String())
+		}
+		updateArgs.afterUpdate = ""
+	}
+
+	// The same with --json.
+	var trackSwitchErr error
+	stdout.Reset()
+	err = runUpdateJSON(clientupdate.Arguments{
+		Logf:          t.Logf,
+		VersionSource: fixedVersionSource{ver: "999.0.0"},
+		ConfirmTrackSwitch: func(from, to string) bool {
+			trackSwitchErr = unattendedTrackSwitchError(from, to)
+			return false
+		},
+	}, &trackSwitchErr)
+	if err == nil || !strings.Contains(err.Error(), "--track=unstable") {
+		t.Errorf("--json track switch: got error %v; want the --unattended one", err)
+	}
+	var got updateJSON
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if got.Result != "aborted" || !strings.Contains(got.Error, "--track=unstable") {
+		t.Errorf("--json track switch: got result %q, error %q; want aborted with the --unattended error", got.Result, got.Error)
+	}
+}
+
+func TestUpdateVerifyOnlyConflicts(t *testing.T) {
+	tstest.Replace(t, &updateArgs.verifyOnly, true)
+	for _, flag := range []*bool{&updateArgs.rollback, &updateArgs.check, &updateArgs.json, &updateArgs.verifyDaemon} {
+		tstest.Replace(t, flag, true)
+		if err := runUpdate(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "--verify-only") {
+			t.Errorf("got error %v; want one about --verify-only", err)
+		}
+		*flag = false
+	}
+}
+
+func TestUpdateInContainer(t *testing.T) {
+	tstest.Replace(t, &containerReason, func() string { return "/.dockerenv exists" })
+	tstest.Replace(t, &updateArgs.yes, true)
+	tstest.Replace(t, &updateArgs.force, false)
+	err := runUpdate(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "/.dockerenv exists") || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("got error %v; want one about the container and --force", err)
+	}
+
+	// Commands that don't install anything still work.
+	tstest.Replace(t, &updateArgs.verifyInstalled, true)
+	tstest.Replace(t, &updateArgs.version, "1.2.3")
+	if err := runUpdate(context.Background(), nil); err == nil || strings.Contains(err.Error(), "container") {
+		t.Errorf("--verify-installed: got error %v; want the flag conflict", err)
+	}
+	updateArgs.verifyInstalled = false
+	updateArgs.version = ""
+
+	// The real detection, from the environment that containerboot is
+	// configured with, which "docker exec" passes on.
+	if runtime.GOOS != "linux" {
+		return
+	}
+	containerReason = clientupdate.ContainerReason
+	t.Setenv("TS_KUBE_SECRET", "tailscale")
+	if err := runUpdate(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "inside a container") {
+		t.Errorf("with $TS_KUBE_SECRET: got error %v; want one about the container", err)
+	}
+}
+
+func TestPrintUpdateStatus(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		desc string
+		st   updateStatusJSON
+		want string
+	}{
+		{
+			desc: "apt-auto-update",
+			st: updateStatusJSON{
+				Current: "1.70.0", Track: "stable", Latest: "1.72.0", UpdateAvailable: true,
+				Platform: "linux/amd64", InstallMethod: "apt", CanAutoUpdate: true, AutoUpdate: &enabled,
+			},
+			want: `Current version:  1.70.0
+Track:            stable
+Latest version:   1.72.0
+Update available: yes
+Install method:   apt
+Auto-updates:     enabled
+`,
+		},
+		{
+			desc: "unsupported",
+			st: updateStatusJSON{
+				Current: "1.72.0", Track: "stable", Latest: "1.72.0", Platform: "darwin/arm64",
+			},
+			want: `Current version:  1.72.0
+Track:            stable
+Latest version:   1.72.0
+Update available: no
+Install method:   none; updates can't be installed with "tailscale update" on darwin/arm64
+Auto-updates:     not supported
+`,
+		},
+		{
+			desc: "no-tailscaled",
+			st: updateStatusJSON{
+				Current: "1.72.0", Track: "unstable", Latest: "1.73.10", UpdateAvailable: true,
+				Platform: "windows/amd64", InstallMethod: "msi", CanAutoUpdate: true,
+			},
+			want: `Current version:  1.72.0
+Track:            unstable
+Latest version:   1.73.10
+Update available: yes
+Install method:   msi
+Auto-updates:     unknown; tailscaled is not reachable
+`,
+		},
+		{
+			desc: "pinned",
+			st: updateStatusJSON{
+				Current: "1.70.0", Track: "stable", Latest: "1.72.0", Pinned: "1.70.0", PinnedBy: "/etc/tailscale/update.conf",
+				Platform: "linux/amd64", InstallMethod: "apt", CanAutoUpdate: true, AutoUpdate: &enabled,
+			},
+			want: `Current version:  1.70.0
+Track:            stable
+Latest version:   1.72.0
+Pinned version:   1.70.0 (by /etc/tailscale/update.conf)
+Update available: no
+Install method:   apt
+Auto-updates:     enabled
+`,
+		},
+		{
+			desc: "reboot-required",
+			st: updateStatusJSON{
+				Current: "1.70.0", Track: "stable", Latest: "1.72.0", UpdateAvailable: true, RebootRequired: true, RebootVersion: "1.72.0",
+				Platform: "windows/amd64", InstallMethod: "msi", CanAutoUpdate: true, AutoUpdate: &enabled,
+			},
+			want: `Current version:  1.70.0
+Track:            stable
+Latest version:   1.72.0
+Update available: yes
+Reboot required:  yes; the update to 1.72.0 needs a reboot to complete
+Install method:   msi
+Auto-updates:     enabled
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var stdout bytes.Buffer
+			tstest.Replace[io.Writer](t, &Stdout, &stdout)
+			printUpdateStatus(&tt.st)
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunAfterUpdate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("--after-update is not supported on Windows")
+	}
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+	tstest.Replace[io.Writer](t, &Stderr, io.Discard)
+
+	if err := runAfterUpdate(`echo "$TS_UPDATE_OLD_VERSION -> $TS_UPDATE_NEW_VERSION"`, "1.68.2", "1.70.0"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "1.68.2 -> 1.70.0\n"; got != want {
+		t.Errorf("got output %q; want %q", got, want)
+	}
+
+	err := runAfterUpdate("exit 3", "1.68.2", "1.70.0")
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("got error %v; want one with the exit status", err)
+	}
+}
+
+// fixedVersionSource is a clientupdate.VersionSource that always returns ver,
+// or err if it's non-nil.
+type fixedVersionSource struct {
+	ver string
+	err error
+}
+
+func (s fixedVersionSource) Latest(ctx context.Context, track, goos, goarch string) (*clientupdate.Release, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &clientupdate.Release{Version: s.ver}, nil
+}
+
+func TestRunUpdateJSON(t *testing.T) {
+	tstest.Replace(t, &updateArgs.dryRun, false)
+	tests := []struct {
+		name       string
+		src        fixedVersionSource
+		wantResult string
+		wantErr    string
+	}{
+		{
+			name:       "already-current",
+			src:        fixedVersionSource{ver: version.Short()},
+			wantResult: "already-current",
+		},
+		{
+			name:       "lookup-failed",
+			src:        fixedVersionSource{err: errors.New("pkgs server unreachable")},
+			wantResult: "failed",
+			wantErr:    "pkgs server unreachable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			tstest.Replace[io.Writer](t, &Stdout, &stdout)
+			err := runUpdateJSON(clientupdate.Arguments{
+				Logf:          t.Logf,
+				VersionSource: tt.src,
+			}, new(error))
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("got error %v; want %q", err, tt.wantErr)
+			}
+			var got updateJSON
+			if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+				t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+			}
+			if got.Result != tt.wantResult || got.Error != tt.wantErr {
+				t.Errorf("got result %q, error %q; want %q, %q", got.Result, got.Error, tt.wantResult, tt.wantErr)
+			}
+			if got.Current != version.Short() {
+				t.Errorf("got current %q; want %q", got.Current, version.Short())
+			}
+		})
+	}
+}
+
+func TestPromptYesNo(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    bool
+		wantOut string
+	}{
+		{in: "y\n", want: true, wantOut: "Continue? [y/n] "},
+		{in: "Yes\n", want: true, wantOut: "Continue? [y/n] "},
+		{in: "no\n", want: false, wantOut: "Continue? [y/n] "},
+		{in: "\n", want: false, wantOut: "Continue? [y/n] No answer; not continuing.\n"},
+		{in: "", want: false, wantOut: "Continue? [y/n] \nNo answer (end of input); not continuing.\n"},
+		{in: "maybe\ny\n", want: true, wantOut: "Continue? [y/n] Please answer \"y\" or \"n\".\nContinue? [y/n] "},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.in), func(t *testing.T) {
+			var stdout bytes.Buffer
+			tstest.Replace[io.Writer](t, &Stdout, &stdout)
+			tstest.Replace[io.Reader](t, &Stdin, strings.NewReader(tt.in))
+			if got := promptYesNo("Continue?"); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := stdout.String(); got != tt.wantOut {
+				t.Errorf("got output %q, want %q", got, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestPrintUpdateList(t *testing.T) {
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+
+	printUpdateList(&clientupdate.VersionList{
+		Current:  "1.58.2",
+		Track:    "stable",
+		Versions: []string{"1.60.0", "1.58.2", "1.56.1"},
+	}, "linux/amd64")
+	want := `Versions on the stable track for linux/amd64, newest first:
+  1.60.0
+  1.58.2 (installed)
+  1.56.1
+`
+	if got := stdout.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	stdout.Reset()
+	printUpdateList(&clientupdate.VersionList{Track: "unstable"}, "linux/amd64")
+	if got, want := stdout.String(), "No versions found on the unstable track for linux/amd64.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestUpdateListJSONEmpty(t *testing.T) {
+	b, err := json.Marshal(newUpdateListJSON(&clientupdate.VersionList{Track: "unstable"}, "linux/amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"versions":[]`) {
+		t.Errorf("got %s, want an empty versions list", b)
+	}
+}
+
 func TestHelpAlias(t *testing.T) {
 	var stdout, stderr bytes.Buffer
 	tstest.Replace[io.Writer](t, &Stdout, &stdout)
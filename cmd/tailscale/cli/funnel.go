@@ -5,14 +5,23 @@
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"net"
+	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
 )
 
@@ -61,22 +70,125 @@ func newFunnelCommand(e *serveEnv) *ffcli.Command {
 	}
 }
 
-// runFunnel is the entry point for the "tailscale funnel" subcommand and
-// manages turning on/off funnel. Funnel is off by default.
+// isFunnelToggle reports whether args to "tailscale funnel" are of the form
+// "<serve-port>[,<serve-port>...] {on|off|pause|resume}", which turns Funnel
+// on or off for ports that are already served, rather than setting up what to
+// serve. Several serve-port arguments may be given, in any of the forms that
+// parseFunnelPorts accepts.
+func isFunnelToggle(args []string) bool {
+	if len(args) < 2 {
+		return false
+	}
+	switch args[len(args)-1] {
+	case "on", "off", "pause", "resume":
+	default:
+		return false
+	}
+	for _, arg := range args[:len(args)-1] {
+		for _, s := range strings.Split(arg, ",") {
+			if !isFunnelPortArg(s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isFunnelPortArg reports whether s looks like a serve port as accepted by
+// parseFunnelPorts: a port number, a serve target like "https:443", or the
+// mount point of a web handler, like "/api". Whether it's actually served is
+// left to parseFunnelPorts.
+func isFunnelPortArg(s string) bool {
+	if strings.HasPrefix(s, "/") {
+		return true
+	}
+	if kind, port, ok := strings.Cut(s, ":"); ok {
+		switch kind {
+		case "https", "http", "tcp", "tls-terminated-tcp":
+		default:
+			return false
+		}
+		s = port
+	}
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
+
+// funnelToggleFlag returns the name of a flag set in e that only applies to
+// the form of "tailscale funnel" described by isFunnelToggle, or an empty
+// string if there is none.
+func (e *serveEnv) funnelToggleFlag() string {
+	switch {
+	case e.force:
+		return "force"
+	case e.funnelFor != 0:
+		return "for"
+	case e.funnelFg:
+		return "fg"
+	case e.hostname != "":
+		return "hostname"
+	case e.funnelTarget != "":
+		return "target"
+	case e.funnelMode != "":
+		return "mode"
+	}
+	return ""
+}
+
+// runFunnel manages turning on/off funnel for "tailscale funnel <serve-port>
+// {on|off|pause|resume}"; see isFunnelToggle. Funnel is off by default.
 //
-// Note: funnel is only supported on single DNS name for now. (2022-11-15)
+// Several ports can be given, as separate arguments or separated by commas,
+// in which case the change is applied to all of them or, if any of them
+// fails, to none of them.
+//
+// Turning Funnel on requires a serve config for each port, unless --force is
+// given, in which case only a warning is printed. With --target, a handler
+// proxying to it is set up at the root of each port instead, in the same
+// SetServeConfig call that turns Funnel on. With --mode, the serve config of
+// each port must also be of that kind; see checkFunnelMode.
+//
+// The host:ports are built from the node's DNS name, or the one selected with
+// --hostname if it has several; see funnelDNSName.
 func (e *serveEnv) runFunnel(ctx context.Context, args []string) error {
-	if len(args) != 2 {
+	if len(args) < 2 {
 		return flag.ErrHelp
 	}
 
 	var on bool
-	switch args[1] {
-	case "on", "off":
-		on = args[1] == "on"
+	action := args[len(args)-1]
+	switch action {
+	case "on", "off", "pause", "resume":
+		on = action == "on" || action == "resume"
 	default:
 		return flag.ErrHelp
 	}
+	if e.funnelFor < 0 || (e.funnelFor > 0 && action != "on") {
+		return errors.New("--for requires a positive duration and can only be used with 'on'")
+	}
+	if e.funnelFg && (e.funnelFor > 0 || action != "on") {
+		return errors.New("--fg can only be used with 'on', and not together with --for")
+	}
+	switch e.funnelMode {
+	case "":
+	case "web", "tcp":
+		if action != "on" {
+			return errors.New("--mode can only be used with 'on'")
+		}
+		if e.funnelMode == "tcp" && e.funnelTarget != "" {
+			return errors.New("--target sets up web handlers; it cannot be used with --mode=tcp")
+		}
+	default:
+		return fmt.Errorf(`invalid --mode %q; must be "web" or "tcp"`, e.funnelMode)
+	}
+	if e.funnelTarget != "" {
+		if action != "on" {
+			return errors.New("--target can only be used with 'on'")
+		}
+		if _, err := ipn.ExpandProxyTargetValue(e.funnelTarget, []string{"http", "https", "https+insecure"}, "http"); err != nil {
+			return fmt.Errorf("invalid --target: %w", err)
+		}
+	}
 	sc, err := e.lc.GetServeConfig(ctx)
 	if err != nil {
 		return err
@@ -85,17 +197,35 @@ func (e *serveEnv) runFunnel(ctx context.Context, args []string) error {
 		sc = new(ipn.ServeConfig)
 	}
 
-	port64, err := strconv.ParseUint(args[0], 10, 16)
+	ports, err := parseFunnelPorts(sc, e.hostname, args[:len(args)-1])
 	if err != nil {
 		return err
 	}
-	port := uint16(port64)
+
+	if action == "on" {
+		if err := checkFunnelEligiblePorts(ports); err != nil {
+			return err
+		}
+	}
+	if action == "on" && e.funnelTarget == "" {
+		for _, port := range ports {
+			if _, ok := sc.TCP[port]; !ok {
+				if e.force {
+					continue
+				}
+				return fmt.Errorf("no serve config for port %d; configure it first, for example with:\n\n\t%s\n\nor use --force to turn on Funnel anyway", port, funnelServeSuggestion(port))
+			}
+			if err := checkFunnelMode(sc, port, e.funnelMode); err != nil {
+				return err
+			}
+		}
+	}
 
 	if on {
 		// Don't block from turning off existing Funnel if
 		// network configuration/capabilities have changed.
 		// Only block from starting new Funnels.
-		if err := e.verifyFunnelEnabled(ctx, port); err != nil {
+		if err := e.verifyFunnelEnabled(ctx, ports...); err != nil {
 			return err
 		}
 	}
@@ -104,33 +234,507 @@ func (e *serveEnv) runFunnel(ctx context.Context, args []string) error {
 	if err != nil {
 		return fmt.Errorf("getting client status: %w", err)
 	}
-	dnsName := strings.TrimSuffix(st.Self.DNSName, ".")
-	hp := ipn.HostPort(dnsName + ":" + strconv.Itoa(int(port)))
-	if on == sc.AllowFunnel[hp] {
+	dnsName, err := funnelDNSName(st, e.hostname)
+	if err != nil {
+		return err
+	}
+	changed := false
+	var turnedOn []uint16 // ports turned on by this command, for --fg and --for
+	// Only sc is modified below, so returning an error leaves the
+	// actual serve config untouched.
+	for _, port := range ports {
+		hp := ipn.HostPort(dnsName + ":" + strconv.Itoa(int(port)))
+		switch action {
+		case "pause":
+			if !sc.PauseFunnel(dnsName, port) {
+				return fmt.Errorf("funnel is not on for %s", hp)
+			}
+		case "resume":
+			if !sc.ResumeFunnel(dnsName, port) {
+				return fmt.Errorf("funnel is not paused for %s", hp)
+			}
+		default:
+			if e.funnelTarget != "" {
+				if err := e.applyWebServe(sc, dnsName, port, true, "/", e.funnelTarget); err != nil {
+					return err
+				}
+				if !sc.AllowFunnel[hp] || sc.PausedFunnel[hp] {
+					sc.SetFunnel(dnsName, port, true)
+					turnedOn = append(turnedOn, port)
+				}
+				break
+			}
+			if on == sc.AllowFunnel[hp] && !sc.PausedFunnel[hp] {
+				// Nothing to do.
+				continue
+			}
+			sc.SetFunnel(dnsName, port, on)
+			if on {
+				turnedOn = append(turnedOn, port)
+			}
+		}
+		changed = true
+	}
+	if !changed {
+		if e.funnelFor > 0 {
+			return errors.New("funnel is already on; turn it off first to use --for")
+		}
+		if e.funnelFg {
+			return errors.New("funnel is already on; turn it off first to use --fg")
+		}
+		printFunnelWarning(sc)
+		return nil
+	}
+
+	if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+		return err
+	}
+	if action != "pause" && e.funnelTarget == "" {
+		// With --target, every port has a handler.
 		printFunnelWarning(sc)
-		// Nothing to do.
+	}
+	if e.funnelFor > 0 || e.funnelFg {
+		return e.turnOffFunnelAfter(ctx, e.funnelFor, dnsName, turnedOn)
+	}
+	return nil
+}
+
+// funnelDNSName returns the DNS name, without the trailing dot, that runFunnel
+// builds host:ports from: hostname if it's one of the node's names in st, or
+// the only name the node has if hostname is empty. It's an error for hostname
+// to be empty when the node has several names, rather than picking one.
+func funnelDNSName(st *ipnstate.Status, hostname string) (string, error) {
+	var names []string
+	for _, n := range append([]string{st.Self.DNSName}, st.CertDomains...) {
+		n = strings.TrimSuffix(n, ".")
+		if n != "" && !slices.Contains(names, n) {
+			names = append(names, n)
+		}
+	}
+	if hostname != "" {
+		hostname = strings.TrimSuffix(hostname, ".")
+		for _, n := range names {
+			if strings.EqualFold(n, hostname) {
+				return n, nil
+			}
+		}
+		return "", fmt.Errorf("%q is not a DNS name of this node; valid names: %q", hostname, names)
+	}
+	switch len(names) {
+	case 0:
+		return "", errors.New("this node has no DNS name; is MagicDNS enabled?")
+	case 1:
+		return names[0], nil
+	}
+	return "", fmt.Errorf("this node has more than one DNS name; use --hostname to select one of: %q", names)
+}
+
+// turnOffFunnelAfter blocks until d has passed or the command is interrupted,
+// and then turns Funnel back off for ports. If d is zero, it waits only for
+// the interruption (or ctx to be done).
+//
+// The serve config has no notion of an expiry, so it's this process that
+// turns Funnel off again; tailscaled does not. That has a few consequences:
+//
+//   - If the process dies without a chance to clean up (SIGKILL, a crash, a
+//     closed terminal that doesn't deliver SIGINT, the machine powering off),
+//     Funnel stays on until it's turned off by hand, even after d has passed.
+//   - The timer runs on this process's clock, so time spent with the machine
+//     asleep may or may not count towards d.
+//   - Only ports that are still on when the time is up are turned off, and
+//     the rest of the serve config is re-read at that point, so changes made
+//     in the meantime (say, by another "tailscale serve" or "funnel off") are
+//     not undone.
+func (e *serveEnv) turnOffFunnelAfter(ctx context.Context, d time.Duration, dnsName string, ports []uint16) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	var expired <-chan time.Time // nil, so never ready, without d
+	if d > 0 {
+		fmt.Fprintf(e.stdout(), "Funnel on; turning it off in %v. Press Ctrl+C to turn it off now.\n", d)
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		expired = timer.C
+	} else {
+		fmt.Fprintln(e.stdout(), "Funnel active; press Ctrl+C to stop and turn it off.")
+	}
+	select {
+	case <-expired:
+	case <-ctx.Done():
+	}
+
+	// ctx is likely canceled by now, so use a fresh one for the cleanup.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sc, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("getting serve config to turn Funnel off; Funnel is still on: %w", err)
+	}
+	if sc == nil {
+		return nil
+	}
+	var off []string
+	for _, port := range ports {
+		hp := ipn.HostPort(dnsName + ":" + strconv.Itoa(int(port)))
+		if sc.AllowFunnel[hp] {
+			sc.SetFunnel(dnsName, port, false)
+			off = append(off, string(hp))
+		}
+	}
+	if len(off) == 0 {
 		return nil
 	}
-	sc.SetFunnel(dnsName, port, on)
+	if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+		return fmt.Errorf("turning Funnel off; Funnel is still on: %w", err)
+	}
+	for _, hp := range off {
+		fmt.Fprintf(e.stdout(), "Funnel off for %s\n", hp)
+	}
+	return nil
+}
+
+// runFunnelReset is the entry point for "tailscale funnel reset", which is
+// the same as "tailscale funnel off --all".
+func (e *serveEnv) runFunnelReset(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+	return e.turnOffAllFunnel(ctx, "Funnel is already off; nothing to reset.")
+}
 
+// turnOffAllFunnel turns off Funnel for every host:port, including paused
+// ones, in a single change and leaves the rest of the serve config alone. It
+// prints each host:port it turned Funnel off for, or noop if there were none.
+func (e *serveEnv) turnOffAllFunnel(ctx context.Context, noop string) error {
+	sc, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if sc == nil || (len(sc.AllowFunnel) == 0 && len(sc.PausedFunnel) == 0) {
+		fmt.Fprintln(e.stdout(), noop)
+		return nil
+	}
+	cleared := slices.AppendSeq(slices.Collect(maps.Keys(sc.AllowFunnel)), maps.Keys(sc.PausedFunnel))
+	slices.Sort(cleared)
+	cleared = slices.Compact(cleared)
+	sc.AllowFunnel = nil
+	sc.PausedFunnel = nil
 	if err := e.lc.SetServeConfig(ctx, sc); err != nil {
 		return err
 	}
-	printFunnelWarning(sc)
+	for _, hp := range cleared {
+		fmt.Fprintf(e.stdout(), "Funnel off for %s\n", hp)
+	}
 	return nil
 }
 
+// funnelListEntry is a host:port that Funnel is on for, as printed by
+// "tailscale funnel list --json" and in "tailscale funnel status --json".
+type funnelListEntry struct {
+	HostPort ipn.HostPort `json:"hostPort"`
+	// URL is the public https URL of HostPort.
+	URL string `json:"url"`
+	// ServeConfigured is whether there is a serve handler for the port,
+	// without which Funnel serves nothing.
+	ServeConfigured bool `json:"serveConfigured"`
+}
+
+// runFunnelList is the entry point for "tailscale funnel list". Unlike
+// "tailscale funnel status", it prints only the host:ports that are exposed
+// to the internet, one per line, or as a JSON array with --json.
+func (e *serveEnv) runFunnelList(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+	sc, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	entries := funnelListEntries(sc)
+	if e.json {
+		j, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		j = append(j, '\n')
+		e.stdout().Write(j)
+		return nil
+	}
+	for _, ent := range entries {
+		if ent.ServeConfigured {
+			fmt.Fprintln(e.stdout(), ent.HostPort)
+		} else {
+			fmt.Fprintf(e.stdout(), "%s (no serve config)\n", ent.HostPort)
+		}
+	}
+	return nil
+}
+
+// runFunnelConns is the entry point for "tailscale funnel connections". It
+// prints the Funnel connections that tailscaled is handling right now, as
+// opposed to watching for new ones.
+func (e *serveEnv) runFunnelConns(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+	conns, err := e.lc.FunnelConns(ctx)
+	if err != nil {
+		return err
+	}
+	if e.json {
+		if conns == nil {
+			conns = []ipn.ActiveFunnelConn{}
+		}
+		j, err := json.MarshalIndent(conns, "", "  ")
+		if err != nil {
+			return err
+		}
+		j = append(j, '\n')
+		e.stdout().Write(j)
+		return nil
+	}
+	printFunnelConns(e.stdout(), conns, time.Now())
+	return nil
+}
+
+// printFunnelConns writes conns to w, one per line, with how long they have
+// been open at now.
+func printFunnelConns(w io.Writer, conns []ipn.ActiveFunnelConn, now time.Time) {
+	if len(conns) == 0 {
+		fmt.Fprintln(w, "No active Funnel connections.")
+		return
+	}
+	for _, c := range conns {
+		fmt.Fprintf(w, "%v -> %s", c.Src, c.Target)
+		if c.IngressNode != "" {
+			fmt.Fprintf(w, " via %s", strings.TrimSuffix(c.IngressNode, "."))
+		}
+		fmt.Fprintf(w, ", open for %v\n", now.Sub(c.Start).Round(time.Second))
+	}
+}
+
+// funnelListEntries returns the host:ports in sc that Funnel is on for, in
+// either the background or a foreground config, sorted by host:port. It
+// returns an empty, non-nil slice if there are none.
+func funnelListEntries(sc *ipn.ServeConfig) []funnelListEntry {
+	entries := []funnelListEntry{}
+	if sc == nil {
+		return entries
+	}
+	var hps []ipn.HostPort
+	for hp, on := range sc.AllowFunnel {
+		if on {
+			hps = append(hps, hp)
+		}
+	}
+	for _, fsc := range sc.Foreground {
+		for hp, on := range fsc.AllowFunnel {
+			if on {
+				hps = append(hps, hp)
+			}
+		}
+	}
+	slices.Sort(hps)
+	for _, hp := range slices.Compact(hps) {
+		ent := funnelListEntry{HostPort: hp, URL: funnelURL(hp)}
+		if port, err := hp.Port(); err == nil {
+			c, _ := sc.FindConfig(port)
+			ent.ServeConfigured = c != nil
+		}
+		entries = append(entries, ent)
+	}
+	return entries
+}
+
+// funnelURL returns the public https URL of hp, leaving out the port if it's
+// the default 443.
+func funnelURL(hp ipn.HostPort) string {
+	host, port, err := net.SplitHostPort(string(hp))
+	if err != nil {
+		return "https://" + string(hp)
+	}
+	if port == "443" {
+		return "https://" + host
+	}
+	return "https://" + net.JoinHostPort(host, port)
+}
+
+// parseFunnelPorts parses the serve ports given to "tailscale funnel", each
+// of which may be a comma-separated list, like "443,8443". Duplicates are
+// removed.
+//
+// Besides port numbers, the ports can be given the way they appear in the
+// serve config sc, and are resolved against it: as a serve target like
+// "https:443" or "tcp:8443", which must exist, or as the mount point of a web
+// handler, like "/api", which must be served on exactly one port. Only the web
+// handlers of hostname are considered, if it's set.
+func parseFunnelPorts(sc *ipn.ServeConfig, hostname string, args []string) ([]uint16, error) {
+	var ports []uint16
+	for _, arg := range args {
+		for _, s := range strings.Split(arg, ",") {
+			var port uint16
+			switch {
+			case strings.Contains(s, ":"):
+				var err error
+				if port, err = resolveFunnelServeTarget(sc, s); err != nil {
+					return nil, err
+				}
+			case strings.HasPrefix(s, "/"):
+				var err error
+				if port, err = resolveFunnelMount(sc, hostname, s); err != nil {
+					return nil, err
+				}
+			default:
+				port64, err := strconv.ParseUint(s, 10, 16)
+				if err != nil {
+					return nil, err
+				}
+				port = uint16(port64)
+			}
+			if !slices.Contains(ports, port) {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// resolveFunnelServeTarget returns the port of target, a serve target like
+// "https:443", "tcp:8443" or "tls-terminated-tcp:10000", if sc serves it.
+func resolveFunnelServeTarget(sc *ipn.ServeConfig, target string) (uint16, error) {
+	kind, portStr, _ := strings.Cut(target, ":")
+	port64, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid serve target %q: %w", target, err)
+	}
+	port := uint16(port64)
+	h := sc.TCP[port]
+	var ok bool
+	switch kind {
+	case "https":
+		ok = h != nil && h.HTTPS
+	case "tcp":
+		ok = h != nil && h.TCPForward != "" && h.TerminateTLS == ""
+	case "tls-terminated-tcp":
+		ok = h != nil && h.TCPForward != "" && h.TerminateTLS != ""
+	default:
+		return 0, fmt.Errorf("invalid serve target %q: Funnel can only be used with https, tcp and tls-terminated-tcp", target)
+	}
+	if !ok {
+		return 0, fmt.Errorf("serve target %q is not configured; see 'tailscale serve status'", target)
+	}
+	return port, nil
+}
+
+// resolveFunnelMount returns the port whose web handlers in sc include one
+// mounted at mount, like "/api". Only the handlers of hostname are considered,
+// if it's set. It's an error for mount to be served on no port or on several.
+func resolveFunnelMount(sc *ipn.ServeConfig, hostname, mount string) (uint16, error) {
+	var ports []uint16
+	for hp, wsc := range sc.Web {
+		if _, ok := wsc.Handlers[mount]; !ok {
+			continue
+		}
+		host, portStr, err := net.SplitHostPort(string(hp))
+		if err != nil || (hostname != "" && !strings.EqualFold(host, strings.TrimSuffix(hostname, "."))) {
+			continue
+		}
+		port64, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			continue
+		}
+		if port := uint16(port64); !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	switch len(ports) {
+	case 0:
+		return 0, fmt.Errorf("no serve handler is mounted at %q; see 'tailscale serve status'", mount)
+	case 1:
+		return ports[0], nil
+	}
+	slices.Sort(ports)
+	return 0, fmt.Errorf("%q is served on ports %s; give the port instead", mount, joinPorts(ports))
+}
+
+// funnelServeMode returns how port is served in sc: "web" for HTTPS with web
+// handlers, "tcp" for a TCP forwarder, with or without TLS termination, or an
+// empty string if it's not served at all.
+func funnelServeMode(sc *ipn.ServeConfig, port uint16) string {
+	h := sc.TCP[port]
+	switch {
+	case h == nil:
+		return ""
+	case h.TCPForward != "":
+		return "tcp"
+	case h.HTTPS:
+		return "web"
+	}
+	return ""
+}
+
+// checkFunnelMode reports an error, with the serve command to change it, if
+// the serve config of port in sc is not of the kind mode, which is "web" or
+// "tcp". An empty mode matches any kind. Ports without a serve config are not
+// an error; they're checked for separately, since --force allows them.
+func checkFunnelMode(sc *ipn.ServeConfig, port uint16, mode string) error {
+	got := funnelServeMode(sc, port)
+	if mode == "" || got == "" || got == mode {
+		return nil
+	}
+	var fix string
+	if mode == "web" {
+		fix = funnelServeSuggestion(port)
+	} else {
+		fix = fmt.Sprintf("tailscale serve --bg --tcp=%d tcp://localhost:%d", port, port)
+	}
+	return fmt.Errorf("port %d is served as %s, not %s; see 'tailscale serve status', and reconfigure it if needed, for example with:\n\n\t%s", port, funnelModeNames[got], funnelModeNames[mode], fix)
+}
+
+// funnelModeNames are the descriptions of the modes of funnelServeMode for
+// messages.
+var funnelModeNames = map[string]string{
+	"web": "web (HTTPS) handlers",
+	"tcp": "a TCP forwarder",
+}
+
+// funnelEligiblePorts are the only ports that Funnel can serve on, regardless
+// of what the node's capabilities allow.
+var funnelEligiblePorts = []uint16{443, 8443, 10000}
+
+// checkFunnelEligiblePorts reports an error listing funnelEligiblePorts if any
+// of ports is not one of them. It's independent of the capability check done
+// by verifyFunnelEnabled, so the guidance is precise even when the node is
+// allowed to use Funnel.
+func checkFunnelEligiblePorts(ports []uint16) error {
+	for _, port := range ports {
+		if !slices.Contains(funnelEligiblePorts, port) {
+			return fmt.Errorf("port %d cannot be used with Funnel; Funnel is only available on ports %s", port, joinPorts(funnelEligiblePorts))
+		}
+	}
+	return nil
+}
+
+// joinPorts returns ports as a comma-separated list.
+func joinPorts(ports []uint16) string {
+	strs := make([]string, len(ports))
+	for i, p := range ports {
+		strs[i] = strconv.Itoa(int(p))
+	}
+	return strings.Join(strs, ", ")
+}
+
 // verifyFunnelEnabled verifies that the self node is allowed to use Funnel.
 //
 // If Funnel is not yet enabled by the current node capabilities,
 // the user is sent through an interactive flow to enable the feature.
 // Once enabled, verifyFunnelEnabled checks that the given port is allowed
-// with Funnel.
+// with Funnel, checking each of ports.
 //
 // If an error is reported, the CLI should stop execution and return the error.
 //
 // verifyFunnelEnabled may refresh the local state and modify the st input.
-func (e *serveEnv) verifyFunnelEnabled(ctx context.Context, port uint16) error {
+func (e *serveEnv) verifyFunnelEnabled(ctx context.Context, ports ...uint16) error {
 	enableErr := e.enableFeatureInteractive(ctx, "funnel", tailcfg.CapabilityHTTPS, tailcfg.NodeAttrFunnel)
 	st, statusErr := e.getLocalClientStatusWithoutPeers(ctx) // get updated status; interactive flow may block
 	switch {
@@ -143,34 +747,54 @@ func (e *serveEnv) verifyFunnelEnabled(ctx context.Context, port uint16) error {
 		// the feature flag on.
 		// TODO(sonia,tailscale/corp#10577): Remove this fallback once the
 		// control flag is turned on for all domains.
-		if err := ipn.CheckFunnelAccess(port, st.Self); err != nil {
-			return err
+		for _, port := range ports {
+			if err := ipn.CheckFunnelAccess(port, st.Self); err != nil {
+				return err
+			}
 		}
 	default:
-		// Done with enablement, make sure the requested port is allowed.
-		if err := ipn.CheckFunnelPort(port, st.Self); err != nil {
-			return err
+		// Done with enablement, make sure the requested ports are allowed.
+		for _, port := range ports {
+			if err := ipn.CheckFunnelPort(port, st.Self); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
 // printFunnelWarning prints a warning if the Funnel is on but there is no serve
-// config for its host:port.
+// config for its host:port, along with a serve command that would fix it, or if
+// the port is set up for web handlers but there are none for the host:port,
+// which leaves Funnel with nothing to serve either.
 func printFunnelWarning(sc *ipn.ServeConfig) {
-	var warn bool
-	for hp, a := range sc.AllowFunnel {
-		if !a {
+	for _, hp := range slices.Sorted(maps.Keys(sc.AllowFunnel)) {
+		if !sc.AllowFunnel[hp] {
+			continue
+		}
+		_, portStr, err := net.SplitHostPort(string(hp))
+		if err != nil {
+			continue
+		}
+		p, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
 			continue
 		}
-		_, portStr, _ := net.SplitHostPort(string(hp))
-		p, _ := strconv.ParseUint(portStr, 10, 16)
-		if _, ok := sc.TCP[uint16(p)]; !ok {
-			warn = true
+		h, ok := sc.TCP[uint16(p)]
+		if !ok {
 			fmt.Fprintf(Stderr, "\nWarning: funnel=on for %s, but no serve config\n", hp)
+			fmt.Fprintf(Stderr, "         run: %s\n", funnelServeSuggestion(uint16(p)))
+			continue
+		}
+		if h.HTTPS && h.TCPForward == "" && (sc.Web[hp] == nil || len(sc.Web[hp].Handlers) == 0) {
+			fmt.Fprintf(Stderr, "\nWarning: funnel=on for %s, but port %d is set up for web handlers and there are none for %s\n", hp, p, hp)
+			fmt.Fprintf(Stderr, "         run: %s\n", funnelServeSuggestion(uint16(p)))
 		}
 	}
-	if warn {
-		fmt.Fprintf(Stderr, "         run: `tailscale serve --help` to see how to configure handlers\n")
-	}
+}
+
+// funnelServeSuggestion returns an example serve command that configures a
+// handler for the Funnel port p, proxying to the same port on localhost.
+func funnelServeSuggestion(p uint16) string {
+	return fmt.Sprintf("tailscale serve --bg --https=%d https+insecure://localhost:%d", p, p)
 }
@@ -11,6 +11,7 @@
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"net/url"
 	"os"
@@ -18,9 +19,11 @@
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/client/tailscale"
@@ -141,6 +144,7 @@ type localServeClient interface {
 	QueryFeature(ctx context.Context, feature string) (*tailcfg.QueryFeatureResponse, error)
 	WatchIPNBus(ctx context.Context, mask ipn.NotifyWatchOpt) (*tailscale.IPNBusWatcher, error)
 	IncrementCounter(ctx context.Context, name string, delta int) error
+	FunnelConns(ctx context.Context) ([]ipn.ActiveFunnelConn, error)
 }
 
 // serveEnv is the environment the serve command runs within. All I/O should be
@@ -151,7 +155,14 @@ type localServeClient interface {
 // It also contains the flags, as registered with newServeCommand.
 type serveEnv struct {
 	// v1 flags
-	json bool // output JSON (status only for now)
+	json      bool          // output JSON (status only for now)
+	force     bool          // turn on funnel even without a serve config
+	funnelFor time.Duration // if non-zero, turn funnel off again after this long
+	funnelFg  bool          // keep running, and turn funnel off again when interrupted
+	hostname  string        // DNS name to turn funnel on/off for, if the node has several
+
+	funnelTarget string // if non-empty, serve this local target on the funnel ports
+	funnelMode   string // "web" or "tcp" to require of the funnel ports' serve config; empty means either
 
 	// v2 specific flags
 	bg               bool      // background mode
@@ -162,6 +173,7 @@ type serveEnv struct {
 	tlsTerminatedTCP uint      // a TLS terminated TCP port
 	subcmd           serveMode // subcommand
 	yes              bool      // update without prompt
+	all              bool      // with "off", turn funnel off for every host:port
 
 	lc localServeClient // localClient interface, specific to serve
 
@@ -606,7 +618,16 @@ func (e *serveEnv) runServeStatus(ctx context.Context, args []string) error {
 		return err
 	}
 	if e.json {
-		j, err := json.MarshalIndent(sc, "", "  ")
+		var v any = sc
+		if e.subcmd == funnel {
+			// Also list the host:ports Funnel is on for, with their
+			// public URLs, alongside the serve config's own fields.
+			v = struct {
+				*ipn.ServeConfig
+				Funnel []funnelListEntry
+			}{sc, funnelListEntries(sc)}
+		}
+		j, err := json.MarshalIndent(v, "", "  ")
 		if err != nil {
 			return err
 		}
@@ -615,7 +636,7 @@ func (e *serveEnv) runServeStatus(ctx context.Context, args []string) error {
 		return nil
 	}
 	printFunnelStatus(ctx)
-	if sc == nil || (len(sc.TCP) == 0 && len(sc.Web) == 0 && len(sc.AllowFunnel) == 0) {
+	if sc == nil || (len(sc.TCP) == 0 && len(sc.Web) == 0 && len(sc.AllowFunnel) == 0 && len(sc.PausedFunnel) == 0) {
 		printf("No serve config\n")
 		return nil
 	}
@@ -636,10 +657,23 @@ func (e *serveEnv) runServeStatus(ctx context.Context, args []string) error {
 		}
 		printf("\n")
 	}
+	for _, hp := range slices.Sorted(maps.Keys(sc.PausedFunnel)) {
+		printf("Funnel paused for %s; run `tailscale funnel %s resume` to turn it back on\n", hp, portOrEmpty(hp))
+	}
 	printFunnelWarning(sc)
 	return nil
 }
 
+// portOrEmpty returns the port of hp, or an empty string if hp has no valid
+// port.
+func portOrEmpty(hp ipn.HostPort) string {
+	p, err := hp.Port()
+	if err != nil {
+		return ""
+	}
+	return strconv.Itoa(int(p))
+}
+
 func printTCPStatusTree(ctx context.Context, sc *ipn.ServeConfig, st *ipnstate.Status) error {
 	dnsName := strings.TrimSuffix(st.Self.DNSName, ".")
 	for p, h := range sc.TCP {
@@ -654,6 +688,8 @@ func printTCPStatusTree(ctx context.Context, sc *ipn.ServeConfig, st *ipnstate.S
 		fStatus := "tailnet only"
 		if sc.AllowFunnel[hp] {
 			fStatus = "Funnel on"
+		} else if sc.PausedFunnel[hp] {
+			fStatus = "Funnel paused"
 		}
 		printf("|-- tcp://%s (%s, %s)\n", hp, tlsStatus, fStatus)
 		for _, a := range st.TailscaleIPs {
@@ -673,6 +709,8 @@ func (e *serveEnv) printWebStatusTree(sc *ipn.ServeConfig, hp ipn.HostPort) erro
 	fStatus := "tailnet only"
 	if sc.AllowFunnel[hp] {
 		fStatus = "Funnel on"
+	} else if sc.PausedFunnel[hp] {
+		fStatus = "Funnel paused"
 	}
 	host, portStr, _ := net.SplitHostPort(string(hp))
 
@@ -76,17 +76,9 @@ type step struct {
 
 	// funnel
 	add(step{reset: true})
-	add(step{
+	add(step{ // no serve config for 443
 		command: cmd("funnel 443 on"),
-		want:    &ipn.ServeConfig{AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true}},
-	})
-	add(step{
-		command: cmd("funnel 443 on"),
-		want:    nil, // nothing to save
-	})
-	add(step{
-		command: cmd("funnel 443 off"),
-		want:    &ipn.ServeConfig{},
+		wantErr: anyErr(),
 	})
 	add(step{
 		command: cmd("funnel 443 off"),
@@ -97,6 +89,30 @@ type step struct {
 		wantErr: exactErr(flag.ErrHelp, "flag.ErrHelp"),
 	})
 
+	add(step{
+		command: cmd("https:443 / http://localhost:3000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+		},
+	})
+	add(step{ // no --force needed with a serve config
+		command: cmd("funnel 443 on"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: "http://127.0.0.1:3000"},
+				}},
+			},
+			AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+		},
+	})
+
 	// https
 	add(step{reset: true})
 	add(step{ // allow omitting port (default to 80)
@@ -859,6 +875,7 @@ type fakeLocalServeClient struct {
 	config               *ipn.ServeConfig
 	setCount             int                       // counts calls to SetServeConfig
 	queryFeatureResponse *mockQueryFeatureResponse // mock response to QueryFeature calls
+	funnelConns          []ipn.ActiveFunnelConn    // returned by FunnelConns
 }
 
 // fakeStatus is a fake ipnstate.Status value for tests.
@@ -916,6 +933,10 @@ func (lc *fakeLocalServeClient) IncrementCounter(ctx context.Context, name strin
 	return nil // unused in tests
 }
 
+func (lc *fakeLocalServeClient) FunnelConns(ctx context.Context) ([]ipn.ActiveFunnelConn, error) {
+	return lc.funnelConns, nil
+}
+
 // exactError returns an error checker that wants exactly the provided want error.
 // If optName is non-empty, it's used in the error message.
 func exactErr(want error, optName ...string) func(error) string {
@@ -58,6 +58,44 @@ type commandInfo struct {
 For more examples and use cases visit our docs site https://tailscale.com/kb/1247/funnel-serve-use-cases
 `)
 
+// funnelToggleHelp is the part of the funnel help about turning Funnel on and
+// off for ports that are already served; see isFunnelToggle.
+var funnelToggleHelp = strings.TrimSpace(`
+TURNING FUNNEL ON AND OFF
+  Funnel can also be turned on or off for a port that is already served with
+  'tailscale serve', without changing what it serves:
+    $ tailscale funnel 443 on
+
+  Several ports can be given, as separate arguments or separated by commas, in
+  which case the change is made for all of them or, if any of them fails, for
+  none of them. Instead of a port number, a port can also be given as the serve
+  target it has, like https:443 or tcp:8443, or as the path of a web handler
+  served on it, like /api.
+
+  Funnel can only be turned on for a port that already has a 'tailscale serve'
+  handler, unless --force is given. With --target, the ports are also set up to
+  proxy to the given local URL, like http://localhost:3000, so that serving and
+  Funnel are turned on together:
+    $ tailscale funnel --target=http://localhost:3000 443 on
+
+  --mode=web or --mode=tcp checks that the ports are served the way intended:
+  with web (HTTPS) handlers, or as TCP forwarders, plain or TLS-terminated.
+  Funnel is not turned on for any of the ports if one of them is served the
+  other way.
+
+  With --fg, the command keeps running after turning Funnel on, and turns it
+  back off when interrupted with Ctrl+C, so that nothing is left exposed after
+  an interactive session. --for does the same, but also turns Funnel off once
+  the duration has passed.
+
+  If the node has more than one DNS name, --hostname selects the one to change
+  Funnel for.
+
+  Turning off Funnel only turns off serving to the internet. It does not affect
+  serving to your tailnet. Pausing Funnel turns it off, but remembers that it
+  was on so that it can be turned back on with 'resume'.
+`)
+
 type serveMode int
 
 const (
@@ -107,7 +145,7 @@ func newServeV2Command(e *serveEnv, subcmd serveMode) *ffcli.Command {
 
 	info := infoMap[subcmd]
 
-	return &ffcli.Command{
+	cmd := &ffcli.Command{
 		Name:      info.Name,
 		ShortHelp: info.ShortHelp,
 		ShortUsage: strings.Join([]string{
@@ -128,6 +166,15 @@ func newServeV2Command(e *serveEnv, subcmd serveMode) *ffcli.Command {
 			fs.UintVar(&e.tcp, "tcp", 0, "Expose a TCP forwarder to forward raw TCP packets at the specified port")
 			fs.UintVar(&e.tlsTerminatedTCP, "tls-terminated-tcp", 0, "Expose a TCP forwarder to forward TLS-terminated TCP packets at the specified port")
 			fs.BoolVar(&e.yes, "yes", false, "Update without interactive prompts (default false)")
+			if subcmd == funnel {
+				fs.BoolVar(&e.force, "force", false, "With \"on\", turn on Funnel even if there is no serve config for the port")
+				fs.BoolVar(&e.funnelFg, "fg", false, "With \"on\", keep running after turning Funnel on, and turn it back off when interrupted with Ctrl+C")
+				fs.DurationVar(&e.funnelFor, "for", 0, "With \"on\", turn Funnel back off after this long, like 30m or 1h; the command keeps running until then")
+				fs.StringVar(&e.hostname, "hostname", "", "With on, off, pause or resume, the DNS name of this node to change Funnel for; required if it has more than one")
+				fs.StringVar(&e.funnelTarget, "target", "", "With \"on\", a local URL to serve on the ports, like http://localhost:3000; replaces any existing handler at /")
+				fs.StringVar(&e.funnelMode, "mode", "", `With "on", require the ports to be served with web handlers ("web") or as TCP forwarders ("tcp"); empty means either`)
+				fs.BoolVar(&e.all, "all", false, "With \"off\", turn off Funnel for every host:port at once, without changing the serve config")
+			}
 		}),
 		UsageFunc: usageFuncNoDefaultValues,
 		Subcommands: []*ffcli.Command{
@@ -140,15 +187,54 @@ func newServeV2Command(e *serveEnv, subcmd serveMode) *ffcli.Command {
 					fs.BoolVar(&e.json, "json", false, "output JSON")
 				}),
 			},
-			{
-				Name:       "reset",
-				ShortUsage: "tailscale " + info.Name + " reset",
-				ShortHelp:  "Reset current " + info.Name + " config",
-				Exec:       e.runServeReset,
-				FlagSet:    e.newFlags("serve-reset", nil),
-			},
+			resetCommand(e, subcmd),
 		},
 	}
+	if subcmd == funnel {
+		cmd.LongHelp += "\n\n" + funnelToggleHelp
+		cmd.ShortUsage += "\ntailscale funnel <serve-port>[,<serve-port>...] {on|off|pause|resume}"
+		cmd.ShortUsage += "\ntailscale funnel off --all\ntailscale funnel list [--json]\ntailscale funnel connections [--json]"
+		cmd.Subcommands = append(cmd.Subcommands, &ffcli.Command{
+			Name:       "list",
+			ShortUsage: "tailscale funnel list [--json]",
+			Exec:       e.runFunnelList,
+			ShortHelp:  "List the host:ports that Funnel is on for",
+			FlagSet: e.newFlags("funnel-list", func(fs *flag.FlagSet) {
+				fs.BoolVar(&e.json, "json", false, "output JSON")
+			}),
+		}, &ffcli.Command{
+			Name:       "connections",
+			ShortUsage: "tailscale funnel connections [--json]",
+			Exec:       e.runFunnelConns,
+			ShortHelp:  "List the Funnel connections that are currently open",
+			FlagSet: e.newFlags("funnel-connections", func(fs *flag.FlagSet) {
+				fs.BoolVar(&e.json, "json", false, "output JSON")
+			}),
+		})
+	}
+	return cmd
+}
+
+// resetCommand returns the "reset" subcommand of subcmd. For funnel, it only
+// turns Funnel off and keeps serving to the tailnet.
+func resetCommand(e *serveEnv, subcmd serveMode) *ffcli.Command {
+	info := infoMap[subcmd]
+	if subcmd == funnel {
+		return &ffcli.Command{
+			Name:       "reset",
+			ShortUsage: "tailscale funnel reset",
+			ShortHelp:  "Turn off Funnel on all ports, without changing the serve config",
+			Exec:       e.runFunnelReset,
+			FlagSet:    e.newFlags("funnel-reset", nil),
+		}
+	}
+	return &ffcli.Command{
+		Name:       "reset",
+		ShortUsage: "tailscale " + info.Name + " reset",
+		ShortHelp:  "Reset current " + info.Name + " config",
+		Exec:       e.runServeReset,
+		FlagSet:    e.newFlags("serve-reset", nil),
+	}
 }
 
 func (e *serveEnv) validateArgs(subcmd serveMode, args []string) error {
@@ -198,21 +284,40 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 			return e.lc.SetServeConfig(ctx, sc)
 		}
 
+		if subcmd == funnel && len(args) > 1 && args[0] == "off" {
+			// Flag parsing stops at "off", so the flags of the
+			// documented "tailscale funnel off --all" are left in args.
+			fs := flag.NewFlagSet("funnel-off", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			fs.BoolVar(&e.all, "all", e.all, "")
+			if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+				fmt.Fprintln(e.stderr(), "Error: only --all can follow \"off\"")
+				return errHelpFunc(subcmd)
+			}
+			args = args[:1]
+		}
+		if subcmd == funnel && isFunnelToggle(args) {
+			return e.runFunnel(ctx, args)
+		}
+		if f := e.funnelToggleFlag(); f != "" {
+			fmt.Fprintf(e.stderr(), "Error: --%s can only be used with on, off, pause or resume\n", f)
+			return errHelpFunc(subcmd)
+		}
+
 		if err := e.validateArgs(subcmd, args); err != nil {
 			return err
 		}
+		if e.all {
+			if len(args) != 1 || args[0] != "off" {
+				fmt.Fprintln(e.stderr(), "Error: --all can only be used with \"off\"")
+				return errHelpFunc(subcmd)
+			}
+			return e.turnOffAllFunnel(ctx, "Funnel is already off; nothing to turn off.")
+		}
 
 		ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 		defer cancel()
 
-		funnel := subcmd == funnel
-		if funnel {
-			// verify node has funnel capabilities
-			if err := e.verifyFunnelEnabled(ctx, 443); err != nil {
-				return err
-			}
-		}
-
 		mount, err := cleanURLPath(e.setPath)
 		if err != nil {
 			return fmt.Errorf("failed to clean the mount point: %w", err)
@@ -224,6 +329,18 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 			return errHelpFunc(subcmd)
 		}
 
+		turnOff := "off" == args[len(args)-1]
+		funnel := subcmd == funnel
+		if funnel && !turnOff {
+			if err := checkFunnelEligiblePorts([]uint16{srvPort}); err != nil {
+				return err
+			}
+			// verify node has funnel capabilities
+			if err := e.verifyFunnelEnabled(ctx, srvPort); err != nil {
+				return err
+			}
+		}
+
 		sc, err := e.lc.GetServeConfig(ctx)
 		if err != nil {
 			return fmt.Errorf("error getting serve config: %w", err)
@@ -245,7 +362,6 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 		// foreground or background.
 		parentSC := sc
 
-		turnOff := "off" == args[len(args)-1]
 		if !turnOff && srvType == serveTypeHTTPS {
 			// Running serve with https requires that the tailnet has enabled
 			// https cert provisioning. Send users through an interactive flow
@@ -636,11 +752,9 @@ func srvTypeAndPortFromFlags(e *serveEnv) (srvType serveType, srvPort uint16, er
 // return false and expects the new code path has enough validations to reject the request.
 func isLegacyInvocation(subcmd serveMode, args []string) (string, bool) {
 	if subcmd == funnel {
-		if len(args) != 2 {
-			return "", false
-		}
-		_, err := strconv.ParseUint(args[0], 10, 16)
-		return "", err == nil && (args[1] == "on" || args[1] == "off")
+		// The old "tailscale funnel <serve-port> {on|off}" is still
+		// supported; see isFunnelToggle.
+		return "", false
 	}
 	turnOff := len(args) > 1 && args[len(args)-1] == "off"
 	if turnOff {
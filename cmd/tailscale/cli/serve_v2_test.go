@@ -7,18 +7,25 @@
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tstest"
 )
 
 func TestServeDevConfigMutations(t *testing.T) {
@@ -338,6 +345,561 @@ type group struct {
 				},
 			},
 		},
+		{
+			name: "funnel_reset",
+			steps: []step{
+				{
+					command: cmd("funnel --bg 3000"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // keeps serving to the tailnet
+					command: cmd("funnel reset"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+					},
+				},
+				{ // already off
+					command: cmd("funnel reset"),
+					want:    nil, // nothing to save
+				},
+				{
+					command: cmd("funnel reset now"),
+					wantErr: exactErr(flag.ErrHelp, "flag.ErrHelp"),
+				},
+			},
+		},
+		{
+			name: "funnel_off_all",
+			steps: []step{
+				{
+					command: cmd("funnel --bg 3000"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // same as "funnel reset"
+					command: cmd("funnel --all off"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+					},
+				},
+				{ // already off
+					command: cmd("funnel off --all"),
+					want:    nil, // nothing to save
+				},
+				{
+					command: cmd("funnel --all 3000"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel off --all --bogus"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel off --all 443"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_pause_resume",
+			steps: []step{
+				{
+					command: cmd("funnel --bg 3000"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{
+					command: cmd("funnel 443 pause"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						PausedFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // already paused
+					command: cmd("funnel 443 pause"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel 443 resume"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // not paused
+					command: cmd("funnel 443 resume"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel 443 pause"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						PausedFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // turning funnel off forgets the paused state, and keeps serving
+					command: cmd("funnel 443 off"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+					},
+				},
+				{ // not on
+					command: cmd("funnel 443 pause"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel 443 on"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // already on
+					command: cmd("funnel 443 on"),
+					want:    nil, // nothing to save
+				},
+			},
+		},
+		{
+			name: "funnel_multiple_ports",
+			steps: []step{
+				{
+					command: cmd("serve --bg 3000"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+					},
+				},
+				{
+					command: cmd("serve --bg --https=8443 3001"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+							"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3001"},
+							}},
+						},
+					},
+				},
+				{
+					command: cmd("funnel 443,8443 on"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+							"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3001"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{
+							"foo.test.ts.net:443":  true,
+							"foo.test.ts.net:8443": true,
+						},
+					},
+				},
+				{
+					command: cmd("funnel 443,8443 pause"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+							"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3001"},
+							}},
+						},
+						PausedFunnel: map[ipn.HostPort]bool{
+							"foo.test.ts.net:443":  true,
+							"foo.test.ts.net:8443": true,
+						},
+					},
+				},
+				{ // repeated port args
+					command: cmd("funnel 8443 443 resume"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+							"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3001"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{
+							"foo.test.ts.net:443":  true,
+							"foo.test.ts.net:8443": true,
+						},
+					},
+				},
+				{
+					command: cmd("funnel 443 8443,443 off"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+							"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3001"},
+							}},
+						},
+					},
+				},
+				{ // 10000 is not served, so neither port is turned on
+					command: cmd("funnel 443,10000 on"),
+					wantErr: anyErr(),
+				},
+				{ // 443 was not turned on
+					command: cmd("funnel 443 off"),
+					want:    nil, // nothing to save
+				},
+				{
+					command: cmd("funnel 443,x on"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_force",
+			steps: []step{
+				{ // no serve config for 443
+					command: cmd("funnel 443 on"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --force 443 on"),
+					want:    &ipn.ServeConfig{AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true}},
+				},
+				{
+					command: cmd("funnel --force 443 on"),
+					want:    nil, // nothing to save
+				},
+				{
+					command: cmd("funnel 443 off"),
+					want:    &ipn.ServeConfig{},
+				},
+				{ // only for turning Funnel on
+					command: cmd("funnel --force 3000"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_for",
+			steps: []step{
+				{ // turned back off once the time is up
+					command: cmd("funnel --force --for=1ms 443 on"),
+					want:    &ipn.ServeConfig{},
+				},
+				{
+					command: cmd("funnel --for=1h 443 off"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --force --for=-1h 443 on"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --force 443 on"),
+					want:    &ipn.ServeConfig{AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true}},
+				},
+				{ // already on, so there's nothing for --for to turn off
+					command: cmd("funnel --force --for=1ms 443 on"),
+					wantErr: anyErr(),
+				},
+				{ // only for turning Funnel on
+					command: cmd("funnel --for=1h 3000"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_eligible_ports",
+			steps: []step{
+				{ // not a port Funnel can use
+					command: cmd("funnel --force 3000 on"),
+					wantErr: exactErrMsg(errors.New("port 3000 cannot be used with Funnel; Funnel is only available on ports 443, 8443, 10000")),
+				},
+				{ // one port not allowed aborts all of them
+					command: cmd("funnel --force 443 80 on"),
+					wantErr: anyErr(),
+				},
+				{ // 443 was not turned on
+					command: cmd("funnel 443 off"),
+					want:    nil, // nothing to save
+				},
+				{ // also when serving and turning Funnel on together
+					command: cmd("funnel --bg --https=3000 localhost:3000"),
+					wantErr: exactErrMsg(errors.New("port 3000 cannot be used with Funnel; Funnel is only available on ports 443, 8443, 10000")),
+				},
+			},
+		},
+		{
+			name: "funnel_fg",
+			steps: []step{
+				{
+					command: cmd("funnel --force 443 on"),
+					want:    &ipn.ServeConfig{AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true}},
+				},
+				{ // already on, so there's nothing for --fg to turn off
+					command: cmd("funnel --force --fg 443 on"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --fg 443 off"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --force --fg --for=1h 443 on"),
+					wantErr: anyErr(),
+				},
+				{ // only for turning Funnel on
+					command: cmd("funnel --fg 3000"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_hostname",
+			steps: []step{
+				{
+					command: cmd("funnel --force --hostname=foo.test.ts.net 443 on"),
+					want:    &ipn.ServeConfig{AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true}},
+				},
+				{ // not one of the node's names
+					command: cmd("funnel --hostname=bar.test.ts.net 443 off"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --hostname=foo.test.ts.net. 443 off"),
+					want:    &ipn.ServeConfig{},
+				},
+				{ // only for turning Funnel on or off
+					command: cmd("funnel --hostname=foo.test.ts.net 3000"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_target",
+			steps: []step{
+				{ // --target sets up the handler and turns funnel on together
+					command: cmd("funnel --target=http://localhost:3000 443 on"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://localhost:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // already on, so only the handler changes
+					command: cmd("funnel --target=4000 443 on"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:4000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{
+					command: cmd("funnel --target=http://localhost:3000 443 off"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --target=ftp://localhost:3000 443 on"),
+					wantErr: anyErr(),
+				},
+				{ // not a Funnel port
+					command: cmd("funnel --target=http://localhost:3000 3000 on"),
+					wantErr: anyErr(),
+				},
+				{ // the serve form takes the target as an argument
+					command: cmd("funnel --target=http://localhost:3000 3000"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_serve_targets",
+			steps: []step{
+				{
+					command: cmd("serve --bg 3000"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+					},
+				},
+				{ // ports can be given as serve targets
+					command: cmd("funnel https:443 on"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{
+					command: cmd("funnel https:443 off"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+					},
+				},
+				{ // or as the mount point of a web handler
+					command: cmd("funnel / on"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // 443 serves https, not tcp
+					command: cmd("funnel tcp:443 off"),
+					wantErr: exactErrMsg(errors.New(`serve target "tcp:443" is not configured; see 'tailscale serve status'`)),
+				},
+				{
+					command: cmd("funnel /api off"),
+					wantErr: exactErrMsg(errors.New(`no serve handler is mounted at "/api"; see 'tailscale serve status'`)),
+				},
+				{
+					command: cmd("funnel http:443 off"),
+					wantErr: anyErr(),
+				},
+			},
+		},
+		{
+			name: "funnel_mode",
+			steps: []step{
+				{
+					command: cmd("serve --bg 3000"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+					},
+				},
+				{ // 443 serves web handlers, not a TCP forwarder
+					command: cmd("funnel --mode=tcp 443 on"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("funnel --mode=web 443 off"),
+					wantErr: exactErrMsg(errors.New("--mode can only be used with 'on'")),
+				},
+				{
+					command: cmd("funnel --mode=http 443 on"),
+					wantErr: exactErrMsg(errors.New(`invalid --mode "http"; must be "web" or "tcp"`)),
+				},
+				{
+					command: cmd("funnel --mode=web 443 on"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+						Web: map[ipn.HostPort]*ipn.WebServerConfig{
+							"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+								"/": {Proxy: "http://127.0.0.1:3000"},
+							}},
+						},
+						AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+					},
+				},
+				{ // only for turning Funnel on
+					command: cmd("funnel --mode=web 3000"),
+					wantErr: anyErr(),
+				},
+			},
+		},
 		{
 			name: "https_insecure",
 			steps: []step{{
@@ -1166,6 +1728,354 @@ func TestMessageForPort(t *testing.T) {
 	}
 }
 
+func TestPrintFunnelWarning(t *testing.T) {
+	var stderr bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stderr, &stderr)
+
+	printFunnelWarning(&ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 10000: {HTTPS: true}},
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{"/": {Proxy: "http://127.0.0.1:3000"}}},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{
+			"foo.test.ts.net:443":   true,
+			"foo.test.ts.net:8443":  true,
+			"foo.test.ts.net:10000": true,
+		},
+	})
+	got := stderr.String()
+	if strings.Contains(got, "foo.test.ts.net:443,") {
+		t.Errorf("unexpected warning for configured port 443:\n%s", got)
+	}
+	const want = "run: tailscale serve --bg --https=8443 https+insecure://localhost:8443\n"
+	if !strings.Contains(got, "funnel=on for foo.test.ts.net:8443, but no serve config") || !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant warning for port 8443 with %q", got, want)
+	}
+	if !strings.Contains(got, "funnel=on for foo.test.ts.net:10000, but port 10000 is set up for web handlers and there are none") {
+		t.Errorf("got:\n%s\nwant warning for port 10000 without web handlers", got)
+	}
+}
+
+func TestFunnelForeground(t *testing.T) {
+	tstest.Replace(t, &Stdout, io.Discard)
+
+	lc := &fakeLocalServeClient{
+		config: &ipn.ServeConfig{
+			AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:8443": true},
+		},
+	}
+	var stdout bytes.Buffer
+	e := &serveEnv{
+		lc:          lc,
+		testFlagOut: io.Discard,
+		testStdout:  &stdout,
+		testStderr:  io.Discard,
+	}
+	// Already canceled, as if interrupted right after turning Funnel on.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newServeV2Command(e, funnel).ParseAndRun(ctx, []string{"--force", "--fg", "443", "on"}); err != nil {
+		t.Fatal(err)
+	}
+	if lc.setCount != 2 {
+		t.Errorf("SetServeConfig called %d times; want 2, to turn Funnel on and back off", lc.setCount)
+	}
+	// Only the port turned on by the command is turned back off.
+	want := map[ipn.HostPort]bool{"foo.test.ts.net:8443": true}
+	if !reflect.DeepEqual(lc.config.AllowFunnel, want) {
+		t.Errorf("AllowFunnel = %v; want %v", lc.config.AllowFunnel, want)
+	}
+	for _, s := range []string{"press Ctrl+C", "Funnel off for foo.test.ts.net:443"} {
+		if !strings.Contains(stdout.String(), s) {
+			t.Errorf("output %q does not contain %q", stdout.String(), s)
+		}
+	}
+}
+
+func TestFunnelDNSName(t *testing.T) {
+	st := func(dnsName string, certDomains ...string) *ipnstate.Status {
+		return &ipnstate.Status{
+			Self:        &ipnstate.PeerStatus{DNSName: dnsName},
+			CertDomains: certDomains,
+		}
+	}
+	tests := []struct {
+		name     string
+		st       *ipnstate.Status
+		hostname string
+		want     string
+		wantErr  bool
+	}{
+		{name: "single", st: st("foo.test.ts.net."), want: "foo.test.ts.net"},
+		{name: "single-cert-domain", st: st("foo.test.ts.net.", "foo.test.ts.net"), want: "foo.test.ts.net"},
+		{name: "single-hostname", st: st("foo.test.ts.net."), hostname: "FOO.test.ts.net.", want: "foo.test.ts.net"},
+		{name: "single-wrong-hostname", st: st("foo.test.ts.net."), hostname: "bar.test.ts.net", wantErr: true},
+		{name: "none", st: st(""), wantErr: true},
+		{name: "multiple", st: st("foo.test.ts.net.", "foo.test.ts.net", "foo.example.com"), wantErr: true},
+		{name: "multiple-hostname", st: st("foo.test.ts.net.", "foo.test.ts.net", "foo.example.com"), hostname: "foo.example.com", want: "foo.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := funnelDNSName(tt.st, tt.hostname)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFunnelPorts(t *testing.T) {
+	sc := &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			443:   {HTTPS: true},
+			8443:  {HTTPS: true},
+			10000: {TCPForward: "127.0.0.1:22"},
+		},
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"foo.test.ts.net:443":  {Handlers: map[string]*ipn.HTTPHandler{"/": {}, "/api": {}}},
+			"foo.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{"/": {}}},
+			"bar.test.ts.net:8443": {Handlers: map[string]*ipn.HTTPHandler{"/admin": {}}},
+		},
+	}
+	tests := []struct {
+		hostname string
+		args     []string
+		want     []uint16
+		wantErr  string
+	}{
+		{args: []string{"443,8443"}, want: []uint16{443, 8443}},
+		{args: []string{"https:8443", "tcp:10000", "8443"}, want: []uint16{8443, 10000}},
+		{args: []string{"/api"}, want: []uint16{443}},
+		{args: []string{"/admin"}, want: []uint16{8443}},
+		{hostname: "foo.test.ts.net.", args: []string{"/admin"}, wantErr: `no serve handler is mounted at "/admin"`},
+		{args: []string{"/"}, wantErr: `"/" is served on ports 443, 8443; give the port instead`},
+		{hostname: "FOO.test.ts.net", args: []string{"/"}, wantErr: `"/" is served on ports 443, 8443`},
+		{args: []string{"tls-terminated-tcp:10000"}, wantErr: "is not configured"},
+		{args: []string{"http:443"}, wantErr: "Funnel can only be used with https, tcp and tls-terminated-tcp"},
+		{args: []string{"https:x"}, wantErr: "invalid serve target"},
+	}
+	for _, tt := range tests {
+		got, err := parseFunnelPorts(sc, tt.hostname, tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFunnelPorts(%q, %q) = %v, %v; want error containing %q", tt.hostname, tt.args, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("parseFunnelPorts(%q, %q) = %v, %v; want %v", tt.hostname, tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestCheckFunnelMode(t *testing.T) {
+	sc := &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			443:   {HTTPS: true},
+			8443:  {TCPForward: "127.0.0.1:5432", TerminateTLS: "foo.test.ts.net"},
+			10000: {TCPForward: "127.0.0.1:22"},
+		},
+	}
+	tests := []struct {
+		port    uint16
+		mode    string
+		wantErr string
+	}{
+		{port: 443, mode: ""},
+		{port: 443, mode: "web"},
+		{port: 443, mode: "tcp", wantErr: "port 443 is served as web (HTTPS) handlers, not a TCP forwarder"},
+		{port: 8443, mode: "tcp"},
+		{port: 10000, mode: "tcp"},
+		{port: 10000, mode: "web", wantErr: "tailscale serve --bg --https=10000 https+insecure://localhost:10000"},
+		{port: 3000, mode: "web"}, // no serve config; checked separately
+	}
+	for _, tt := range tests {
+		err := checkFunnelMode(sc, tt.port, tt.mode)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkFunnelMode(%d, %q) = %v; want nil", tt.port, tt.mode, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("checkFunnelMode(%d, %q) = %v; want error containing %q", tt.port, tt.mode, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFunnelList(t *testing.T) {
+	lc := &fakeLocalServeClient{config: &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+		AllowFunnel: map[ipn.HostPort]bool{
+			"foo.test.ts.net:8443": true,
+			"foo.test.ts.net:443":  true,
+		},
+		PausedFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:10000": true},
+		Foreground: map[string]*ipn.ServeConfig{
+			"session": {
+				TCP:         map[uint16]*ipn.TCPPortHandler{10000: {HTTPS: true}},
+				AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:10000": true},
+			},
+		},
+	}}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{
+			args: []string{"list"},
+			want: "foo.test.ts.net:10000\nfoo.test.ts.net:443\nfoo.test.ts.net:8443 (no serve config)\n",
+		},
+		{
+			args: []string{"list", "--json"},
+			want: `[
+  {
+    "hostPort": "foo.test.ts.net:10000",
+    "url": "https://foo.test.ts.net:10000",
+    "serveConfigured": true
+  },
+  {
+    "hostPort": "foo.test.ts.net:443",
+    "url": "https://foo.test.ts.net",
+    "serveConfigured": true
+  },
+  {
+    "hostPort": "foo.test.ts.net:8443",
+    "url": "https://foo.test.ts.net:8443",
+    "serveConfigured": false
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		var stdout bytes.Buffer
+		e := &serveEnv{lc: lc, testFlagOut: io.Discard, testStdout: &stdout}
+		if err := newServeV2Command(e, funnel).ParseAndRun(context.Background(), tt.args); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if got := stdout.String(); got != tt.want {
+			t.Errorf("%v: got:\n%s\nwant:\n%s", tt.args, got, tt.want)
+		}
+	}
+
+	var stdout bytes.Buffer
+	e := &serveEnv{lc: &fakeLocalServeClient{}, testFlagOut: io.Discard, testStdout: &stdout}
+	if err := newServeV2Command(e, funnel).ParseAndRun(context.Background(), []string{"list", "--json"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "[]\n" {
+		t.Errorf("with no serve config, got %q; want %q", got, "[]\n")
+	}
+}
+
+func TestFunnelOffAll(t *testing.T) {
+	lc := &fakeLocalServeClient{config: &ipn.ServeConfig{
+		TCP:          map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}, 8443: {HTTPS: true}},
+		AllowFunnel:  map[ipn.HostPort]bool{"foo.test.ts.net:8443": true, "foo.test.ts.net:443": true},
+		PausedFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:10000": true},
+	}}
+	for _, args := range [][]string{{"off", "--all"}, {"reset"}} {
+		var stdout bytes.Buffer
+		e := &serveEnv{lc: lc, testFlagOut: io.Discard, testStdout: &stdout}
+		if err := newServeV2Command(e, funnel).ParseAndRun(context.Background(), args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		want := "Funnel off for foo.test.ts.net:10000\n" +
+			"Funnel off for foo.test.ts.net:443\n" +
+			"Funnel off for foo.test.ts.net:8443\n"
+		if args[0] == "reset" {
+			// The first run turned it all off already.
+			want = "Funnel is already off; nothing to reset.\n"
+		}
+		if got := stdout.String(); got != want {
+			t.Errorf("%v: got %q; want %q", args, got, want)
+		}
+	}
+	if lc.setCount != 1 {
+		t.Errorf("SetServeConfig called %d times; want 1", lc.setCount)
+	}
+	if len(lc.config.TCP) != 2 {
+		t.Errorf("serve handlers changed: %+v", lc.config.TCP)
+	}
+}
+
+func TestFunnelConns(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	conns := []ipn.ActiveFunnelConn{
+		{Src: netip.MustParseAddrPort("203.0.113.1:1234"), Target: "foo.test.ts.net:443", IngressNode: "ingress.example.ts.net.", Start: start},
+		{Src: netip.MustParseAddrPort("[2001:db8::1]:5678"), Target: "foo.test.ts.net:8443", Start: start.Add(90 * time.Second)},
+	}
+
+	var buf bytes.Buffer
+	printFunnelConns(&buf, conns, start.Add(2*time.Minute))
+	want := "203.0.113.1:1234 -> foo.test.ts.net:443 via ingress.example.ts.net, open for 2m0s\n" +
+		"[2001:db8::1]:5678 -> foo.test.ts.net:8443, open for 30s\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	var stdout bytes.Buffer
+	e := &serveEnv{lc: &fakeLocalServeClient{funnelConns: conns[:1]}, testFlagOut: io.Discard, testStdout: &stdout}
+	if err := newServeV2Command(e, funnel).ParseAndRun(context.Background(), []string{"connections", "--json"}); err != nil {
+		t.Fatal(err)
+	}
+	var got []ipn.ActiveFunnelConn
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, conns[:1]) {
+		t.Errorf("--json: got %+v; want %+v", got, conns[:1])
+	}
+
+	for _, args := range [][]string{{"connections"}, {"connections", "--json"}} {
+		stdout.Reset()
+		e := &serveEnv{lc: &fakeLocalServeClient{}, testFlagOut: io.Discard, testStdout: &stdout}
+		if err := newServeV2Command(e, funnel).ParseAndRun(context.Background(), args); err != nil {
+			t.Fatal(err)
+		}
+		want := "No active Funnel connections.\n"
+		if len(args) > 1 {
+			want = "[]\n"
+		}
+		if got := stdout.String(); got != want {
+			t.Errorf("%v with none: got %q; want %q", args, got, want)
+		}
+	}
+}
+
+func TestFunnelStatusJSON(t *testing.T) {
+	lc := &fakeLocalServeClient{config: &ipn.ServeConfig{
+		TCP:         map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+		AllowFunnel: map[ipn.HostPort]bool{"foo.test.ts.net:443": true},
+	}}
+	for _, subcmd := range []serveMode{serve, funnel} {
+		var stdout bytes.Buffer
+		e := &serveEnv{lc: lc, testFlagOut: io.Discard, testStdout: &stdout}
+		if err := newServeV2Command(e, subcmd).ParseAndRun(context.Background(), []string{"status", "--json"}); err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			AllowFunnel map[ipn.HostPort]bool
+			Funnel      []funnelListEntry
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.AllowFunnel["foo.test.ts.net:443"] {
+			t.Errorf("%v: serve config missing from output:\n%s", infoMap[subcmd].Name, stdout.Bytes())
+		}
+		var want []funnelListEntry
+		if subcmd == funnel {
+			want = []funnelListEntry{{HostPort: "foo.test.ts.net:443", URL: "https://foo.test.ts.net", ServeConfigured: true}}
+		}
+		if !reflect.DeepEqual(got.Funnel, want) {
+			t.Errorf("%v: Funnel = %+v; want %+v", infoMap[subcmd].Name, got.Funnel, want)
+		}
+	}
+}
+
 func TestIsLegacyInvocation(t *testing.T) {
 	tests := []struct {
 		subcmd      serveMode
@@ -1239,15 +2149,15 @@ func TestIsLegacyInvocation(t *testing.T) {
 			expected:    true,
 			translation: "tailscale serve --bg --tls-terminated-tcp 443 tcp://localhost:80",
 		},
-		{
+		{ // still supported; see isFunnelToggle
 			subcmd:   funnel,
 			args:     []string{"443", "on"},
-			expected: true,
+			expected: false,
 		},
 		{
 			subcmd:   funnel,
 			args:     []string{"443", "off"},
-			expected: true,
+			expected: false,
 		},
 
 		{
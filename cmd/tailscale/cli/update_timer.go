@@ -0,0 +1,254 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"tailscale.com/clientupdate"
+)
+
+const (
+	// systemdUnitDir is where "tailscale update --enable-auto" installs its
+	// systemd units.
+	systemdUnitDir = "/etc/systemd/system"
+
+	autoUpdateService = "tailscale-update.service"
+	autoUpdateTimer   = "tailscale-update.timer"
+)
+
+// autoUpdateUnits returns the contents of the systemd service and timer units
+// that run exe to update to the latest stable release every day at
+// hour:minute, local time.
+func autoUpdateUnits(exe string, hour, minute int) (service, timer string) {
+	service = fmt.Sprintf(`# Installed by "tailscale update --enable-auto".
+# Remove with "tailscale update --disable-auto".
+[Unit]
+Description=Tailscale automatic update
+Documentation=https://tailscale.com/kb/1067/update
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s update --yes --track=stable
+`, exe)
+	timer = fmt.Sprintf(`# Installed by "tailscale update --enable-auto".
+# Remove with "tailscale update --disable-auto".
+[Unit]
+Description=Daily Tailscale automatic update
+
+[Timer]
+OnCalendar=*-*-* %02d:%02d:00
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, hour, minute)
+	return service, timer
+}
+
+// checkAutoUpdateTimerSupported returns an error if the systemd auto-update
+// timer cannot be managed on this system.
+func checkAutoUpdateTimerSupported() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("--enable-auto and --disable-auto are only supported on Linux with systemd, not %s; see 'tailscale set --auto-update'", runtime.GOOS)
+	}
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return errors.New("--enable-auto and --disable-auto require systemd, which is not running")
+	}
+	return clientupdate.RequireRoot()
+}
+
+// enableAutoUpdateTimer installs and starts a systemd timer that runs
+// "tailscale update --yes" on the stable track once a day, at a random time
+// so that not every node updates at once.
+func enableAutoUpdateTimer(ctx context.Context) error {
+	if err := checkAutoUpdateTimerSupported(); err != nil {
+		return err
+	}
+	if reason := autoUpdatesManagedElsewhere(ctx); reason != "" {
+		return fmt.Errorf("%s; not installing a %s timer to avoid duplicate updates", reason, autoUpdateTimer)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	minuteOfDay := rand.N(24 * 60)
+	hour, minute := minuteOfDay/60, minuteOfDay%60
+	service, timer := autoUpdateUnits(exe, hour, minute)
+	if err := os.WriteFile(filepath.Join(systemdUnitDir, autoUpdateService), []byte(service), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(systemdUnitDir, autoUpdateTimer), []byte(timer), 0644); err != nil {
+		return err
+	}
+	if err := runSystemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := runSystemctl("enable", "--now", autoUpdateTimer); err != nil {
+		return err
+	}
+	printf("Automatic updates enabled: %q runs daily at %02d:%02d local time.\n", exe+" update --yes --track=stable", hour, minute)
+	printf("Run 'systemctl list-timers %s' to see the next run, or 'tailscale update --disable-auto' to turn this off.\n", autoUpdateTimer)
+	return nil
+}
+
+// disableAutoUpdateTimer stops and removes the systemd timer installed by
+// enableAutoUpdateTimer. It's not an error if it's not installed.
+func disableAutoUpdateTimer() error {
+	if err := checkAutoUpdateTimerSupported(); err != nil {
+		return err
+	}
+	timerPath := filepath.Join(systemdUnitDir, autoUpdateTimer)
+	if _, err := os.Stat(timerPath); os.IsNotExist(err) {
+		outln("Automatic updates are not enabled; nothing to do.")
+		return nil
+	}
+	if err := runSystemctl("disable", "--now", autoUpdateTimer); err != nil {
+		return err
+	}
+	for _, name := range []string{autoUpdateTimer, autoUpdateService} {
+		if err := os.Remove(filepath.Join(systemdUnitDir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := runSystemctl("daemon-reload"); err != nil {
+		return err
+	}
+	outln("Automatic updates disabled.")
+	return nil
+}
+
+func runSystemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w, output:\n%s", strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// autoUpdatesManagedElsewhere returns a description of what else updates
+// Tailscale automatically on this system, or "" if nothing does.
+func autoUpdatesManagedElsewhere(ctx context.Context) string {
+	if prefs, err := localClient.GetPrefs(ctx); err == nil && prefs.AutoUpdate.Apply.EqualBool(true) {
+		return "tailscaled already applies updates automatically ('tailscale set --auto-update')"
+	}
+	if exec.Command("dpkg", "-s", "tailscale").Run() == nil {
+		if conf, err := os.ReadFile("/etc/apt/apt.conf.d/20auto-upgrades"); err == nil && unattendedUpgradesEnabled(conf) && unattendedUpgradesCoverTailscale(readAptConf()) {
+			return "unattended-upgrades is enabled and configured to update packages from the Tailscale repository"
+		}
+	}
+	for _, timer := range []string{"dnf-automatic-install.timer", "dnf-automatic.timer"} {
+		if exec.Command("systemctl", "is-enabled", "--quiet", timer).Run() == nil {
+			return fmt.Sprintf("%s is enabled and may already update the tailscale package", timer)
+		}
+	}
+	return ""
+}
+
+// readAptConf returns the contents of the apt configuration files, in the order
+// that apt reads them. Unreadable files are skipped.
+func readAptConf() [][]byte {
+	paths, _ := filepath.Glob("/etc/apt/apt.conf.d/*")
+	paths = append([]string{"/etc/apt/apt.conf"}, paths...)
+	var confs [][]byte
+	for _, path := range paths {
+		if b, err := os.ReadFile(path); err == nil {
+			confs = append(confs, b)
+		}
+	}
+	return confs
+}
+
+var (
+	// unattendedOriginsRE matches the Origins-Pattern and Allowed-Origins
+	// lists of unattended-upgrades, in either the block or the single value
+	// form of apt's configuration syntax.
+	unattendedOriginsRE = regexp.MustCompile(`Unattended-Upgrade::(Origins-Pattern|Allowed-Origins)(?:\s*\{([^}]*)\}|::\s*("[^"]*"))`)
+	aptConfStringRE     = regexp.MustCompile(`"([^"]*)"`)
+	aptConfCommentRE    = regexp.MustCompile(`(?m)(^|\s)(//|#).*$`)
+)
+
+// unattendedUpgradesCoverTailscale reports whether the unattended-upgrades
+// configuration in confs allows upgrading packages from the Tailscale apt
+// repository, whose Release file has "Origin: Tailscale" and "Label:
+// Tailscale". Only the origin, label and site of the patterns are checked;
+// other fields, like the codename, are assumed to match.
+func unattendedUpgradesCoverTailscale(confs [][]byte) bool {
+	for _, conf := range confs {
+		conf = aptConfCommentRE.ReplaceAll(conf, nil)
+		for _, m := range unattendedOriginsRE.FindAllSubmatch(conf, -1) {
+			kind, list := string(m[1]), m[2]
+			if list == nil {
+				list = m[3]
+			}
+			for _, s := range aptConfStringRE.FindAllSubmatch(list, -1) {
+				if unattendedOriginMatchesTailscale(kind, string(s[1])) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// unattendedOriginMatchesTailscale reports whether an entry of the given
+// unattended-upgrades list ("Origins-Pattern" or "Allowed-Origins") matches
+// the Tailscale apt repository.
+func unattendedOriginMatchesTailscale(kind, entry string) bool {
+	match := func(pattern, value string) bool {
+		ok, _ := path.Match(pattern, value)
+		return ok
+	}
+	if kind == "Allowed-Origins" {
+		// "origin:archive"
+		origin, _, _ := strings.Cut(entry, ":")
+		return match(origin, "Tailscale")
+	}
+	// "key=value,key=value"
+	for _, field := range strings.Split(entry, ",") {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "o", "origin", "l", "label":
+			if !match(v, "Tailscale") {
+				return false
+			}
+		case "site":
+			if !match(v, "pkgs.tailscale.com") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var unattendedUpgradeRE = regexp.MustCompile(`^\s*APT::Periodic::Unattended-Upgrade\s+"([0-9]+)"\s*;`)
+
+// unattendedUpgradesEnabled reports whether the apt configuration in conf,
+// usually /etc/apt/apt.conf.d/20auto-upgrades, turns on unattended-upgrades.
+func unattendedUpgradesEnabled(conf []byte) bool {
+	enabled := false
+	for _, line := range bytes.Split(conf, []byte("\n")) {
+		// Later lines override earlier ones.
+		if m := unattendedUpgradeRE.FindSubmatch(line); m != nil {
+			enabled = string(m[1]) != "0"
+		}
+	}
+	return enabled
+}
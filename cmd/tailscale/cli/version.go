@@ -6,13 +6,23 @@
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/clientupdate"
+	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/version"
+	"tailscale.com/version/distro"
 )
 
 var versionCmd = &ffcli.Command{
@@ -24,67 +34,491 @@
 		fs.BoolVar(&versionArgs.daemon, "daemon", false, "also print local node's daemon version")
 		fs.BoolVar(&versionArgs.json, "json", false, "output in JSON format")
 		fs.BoolVar(&versionArgs.upstream, "upstream", false, "fetch and print the latest upstream release version from pkgs.tailscale.com")
+		fs.StringVar(&versionArgs.upstreamTrack, "upstream-track", "", `with --upstream, the track to look up the latest version on: "stable" or "unstable"; empty means the track of this build`)
+		fs.BoolVar(&versionArgs.upgradeAvailable, "upgrade-available", false, "check whether a newer version is available on the client's update track, and exit with status 2 if so; with --daemon, the latest version that tailscaled last heard of is used if it has one, unless --no-cache is given")
+		fs.BoolVar(&versionArgs.verbose, "verbose", false, "also print the Go version, platform, distro and build tags")
+		fs.BoolVar(&versionArgs.clientOnly, "client-only", false, "print only the client version, without any prefix, for use from scripts")
+		fs.BoolVar(&versionArgs.daemonOnly, "daemon-only", false, "print only the local node's daemon version, without any prefix, for use from scripts")
+		fs.StringVar(&versionArgs.compare, "compare", "", `compare the client version against this version, like "1.56.0", and print "older", "same" or "newer"`)
+		fs.BoolVar(&versionArgs.compareExitCode, "compare-exit-code", false, "with --compare, exit with status 0 if the client version is the same, 2 if it's older and 3 if it's newer, instead of always 0")
+		fs.BoolVar(&versionArgs.noCache, "no-cache", false, "with --upstream or --upgrade-available, look up the latest version even if it was looked up within the last hour")
 		return fs
 	})(),
 	Exec: runVersion,
 }
 
+// versionJSONSchemaVersion is the "schemaVersion" field of the output of
+// "tailscale version --json". It's bumped when a field is removed or renamed or
+// changes meaning, but not when one is added, so that parsers can tell output
+// they may not understand.
+const versionJSONSchemaVersion = 1
+
 var versionArgs struct {
-	daemon   bool // also check local node's daemon version
-	json     bool
-	upstream bool
+	daemon           bool // also check local node's daemon version
+	json             bool
+	upstream         bool
+	upgradeAvailable bool // compare against the latest version; exit 2 if newer
+	noCache          bool // don't use a cached latest version
+	verbose          bool // also print the build environment
+	clientOnly       bool // only print the bare client version
+	daemonOnly       bool // only print the bare daemon version
+
+	upstreamTrack   string // track for upstream; empty means current
+	compare         string // version to compare the client version against
+	compareExitCode bool   // with compare, encode the result in the exit status
 }
 
 func runVersion(ctx context.Context, args []string) error {
 	if len(args) > 0 {
 		return fmt.Errorf("too many non-flag arguments: %q", args)
 	}
+	if versionArgs.clientOnly || versionArgs.daemonOnly {
+		return runVersionOnly(ctx)
+	}
+	if versionArgs.compare != "" {
+		return runVersionCompare()
+	} else if versionArgs.compareExitCode {
+		return errors.New("--compare-exit-code requires --compare")
+	}
 	var err error
 	var st *ipnstate.Status
+	var prefs *ipn.Prefs
+	daemonDown := false
 
 	if versionArgs.daemon {
 		st, err = localClient.StatusWithoutPeers(ctx)
+		if isTailscaledConnectError(err) {
+			// Still print the client version; the daemon being stopped
+			// is the common reason to be checking versions.
+			daemonDown = true
+			st, err = nil, nil
+		}
 		if err != nil {
 			return err
 		}
+		if st != nil && versionArgs.json {
+			prefs, err = localClient.GetPrefs(ctx)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	var upstreamVer string
+	requestedTrack := clientupdate.NormalizeTrack(versionArgs.upstreamTrack)
+	upstreamTrack := requestedTrack
+	switch upstreamTrack {
+	case "":
+		upstreamTrack = clientupdate.CurrentTrack
+	case clientupdate.StableTrack, clientupdate.UnstableTrack:
+		if !versionArgs.upstream {
+			return errors.New("--upstream-track requires --upstream")
+		}
+	default:
+		return fmt.Errorf("invalid --upstream-track %q; must be %q or %q", upstreamTrack, clientupdate.StableTrack, clientupdate.UnstableTrack)
+	}
+	var upstream *clientupdate.Release
 	if versionArgs.upstream {
-		upstreamVer, err = clientupdate.LatestTailscaleVersion(clientupdate.CurrentTrack)
+		upstream, err = clientupdate.LatestTailscaleRelease(ctx, upstreamTrack, !versionArgs.noCache)
 		if err != nil {
 			return err
 		}
 	}
 
+	var check *clientupdate.CheckResult
+	latestSource := "" // where check.Latest came from; see the latestSource JSON field
+	if versionArgs.upgradeAvailable {
+		if st != nil && !versionArgs.noCache {
+			check = daemonUpgradeCheck(version.Short(), st)
+			latestSource = "daemon"
+		}
+		if check == nil {
+			check, err = checkUpgradeAvailable(ctx)
+			if err != nil {
+				return err
+			}
+			latestSource = "lookup"
+		}
+	}
+
 	if versionArgs.json {
 		m := version.GetMeta()
 		if st != nil {
 			m.DaemonLong = st.Version
 		}
 		out := struct {
+			SchemaVersion int `json:"schemaVersion"` // versionJSONSchemaVersion
 			version.Meta
-			Upstream string `json:"upstream,omitempty"`
+			buildEnv
+			Upstream         string    `json:"upstream,omitempty"`
+			UpstreamTrack    string    `json:"upstreamTrack,omitempty"`
+			UpstreamDate     time.Time `json:"upstreamDate,omitzero"`
+			UpstreamSHA256   string    `json:"upstreamSHA256,omitempty"`
+			Latest           string    `json:"latest,omitempty"`
+			Track            string    `json:"track,omitempty"`
+			UpgradeAvailable *bool     `json:"upgradeAvailable,omitempty"`
+			// Pinned is the version that the update config file at
+			// pinnedBy pins updates to, instead of latest.
+			Pinned   string `json:"pinned,omitempty"`
+			PinnedBy string `json:"pinnedBy,omitempty"`
+			// LatestSource is where latest came from: "daemon" for the
+			// latest version that tailscaled last heard of, as used for
+			// auto-updates, or "lookup" for one looked up by the CLI.
+			LatestSource string `json:"latestSource,omitempty"`
+			// Mismatch is whether the client and daemon major.minor
+			// versions differ. It's only set with --daemon.
+			Mismatch *bool `json:"mismatch,omitempty"`
+			// AutoUpdate is the node's auto-update prefs. It's only
+			// set with --daemon.
+			AutoUpdate *autoUpdateStatus `json:"autoUpdate,omitempty"`
+			// DaemonRunning is whether tailscaled could be reached.
+			// It's only set with --daemon; when false, daemonLong,
+			// mismatch and autoUpdate are omitted.
+			DaemonRunning *bool `json:"daemonRunning,omitempty"`
 		}{
-			Meta:     m,
-			Upstream: upstreamVer,
+			SchemaVersion: versionJSONSchemaVersion,
+			Meta:          m,
+			buildEnv:      getBuildEnv(),
+		}
+		if upstream != nil {
+			out.Upstream = upstream.Version
+			out.UpstreamTrack = upstreamTrack
+			out.UpstreamDate = upstream.Date
+			out.UpstreamSHA256 = upstream.SHA256
+		}
+		if st != nil {
+			mismatch := versionsMismatch(version.Short(), st.Version)
+			out.Mismatch = &mismatch
+		}
+		if prefs != nil {
+			out.AutoUpdate = getAutoUpdateStatus(prefs.AutoUpdate)
+		}
+		if versionArgs.daemon {
+			running := !daemonDown
+			out.DaemonRunning = &running
+		}
+		if check != nil {
+			out.Latest = check.Latest
+			out.Track = check.Track
+			out.UpgradeAvailable = &check.UpdateAvailable
+			out.LatestSource = latestSource
+			out.Pinned = check.Pinned
+			out.PinnedBy = check.PinnedBy
 		}
 		e := json.NewEncoder(Stdout)
 		e.SetIndent("", "\t")
-		return e.Encode(out)
+		if err := e.Encode(out); err != nil {
+			return err
+		}
+		exitIfUpgradeAvailable(check)
+		return nil
 	}
 
-	if st == nil {
+	if st == nil && !daemonDown {
 		outln(version.String())
 		if versionArgs.upstream {
-			printf("  upstream: %s\n", upstreamVer)
+			printf("  upstream: %s%s\n", upstream.Version, releaseDetails(upstream, requestedTrack))
+		}
+		if check != nil {
+			printf("  latest: %s (%s track)\n", check.Latest, check.Track)
+			if check.Pinned != "" {
+				printf("  pinned: %s (by %s)\n", check.Pinned, check.PinnedBy)
+			}
+		}
+	} else {
+		printf("Client: %s\n", version.String())
+		if daemonDown {
+			printf("Daemon: not running (could not connect to tailscaled)\n")
+		} else {
+			printf("Daemon: %s\n", st.Version)
+		}
+		if st != nil && versionsMismatch(version.Short(), st.Version) {
+			fmt.Fprintf(Stderr, "Warning: client %s and daemon %s versions differ; restart tailscaled or finish updating.\n", majorMinor(version.Short()), majorMinor(st.Version))
+		}
+		if versionArgs.upstream {
+			printf("Upstream: %s%s\n", upstream.Version, releaseDetails(upstream, requestedTrack))
+		}
+		if check != nil {
+			printf("Latest: %s (%s)\n", check.Latest, latestDetails(check, latestSource))
+			if check.Pinned != "" {
+				printf("Pinned: %s (by %s)\n", check.Pinned, check.PinnedBy)
+			}
 		}
-		return nil
 	}
-	printf("Client: %s\n", version.String())
-	printf("Daemon: %s\n", st.Version)
-	if versionArgs.upstream {
-		printf("Upstream: %s\n", upstreamVer)
+	if versionArgs.verbose {
+		be := getBuildEnv()
+		printf("Go: %s\n", be.GoVersion)
+		printf("Platform: %s/%s\n", be.OS, be.Arch)
+		if be.Distro != "" {
+			printf("Distro: %s\n", be.Distro)
+		}
+		if len(be.BuildTags) > 0 {
+			printf("Build tags: %s\n", strings.Join(be.BuildTags, ","))
+		}
+	}
+	if check != nil {
+		if check.UpdateAvailable {
+			outln("An upgrade is available.")
+		} else {
+			outln("Tailscale is up to date.")
+		}
+	}
+	exitIfUpgradeAvailable(check)
+	return nil
+}
+
+// runVersionOnly prints just the client or daemon version, as selected with
+// --client-only or --daemon-only, or with --json, an object with just the
+// "long" or "daemonLong" field of the full output.
+func runVersionOnly(ctx context.Context) error {
+	if versionArgs.clientOnly && versionArgs.daemonOnly {
+		return errors.New("cannot specify both --client-only and --daemon-only")
+	}
+	if versionArgs.daemon || versionArgs.upstream || versionArgs.upgradeAvailable || versionArgs.verbose {
+		return errors.New("cannot specify --client-only or --daemon-only with --daemon, --upstream, --upgrade-available or --verbose")
+	}
+	out := struct {
+		SchemaVersion int    `json:"schemaVersion"` // versionJSONSchemaVersion
+		Long          string `json:"long,omitempty"`
+		DaemonLong    string `json:"daemonLong,omitempty"`
+	}{SchemaVersion: versionJSONSchemaVersion}
+	if versionArgs.clientOnly {
+		out.Long = version.Long()
+	} else {
+		st, err := localClient.StatusWithoutPeers(ctx)
+		if isTailscaledConnectError(err) {
+			return fixTailscaledConnectError(err)
+		}
+		if err != nil {
+			return err
+		}
+		out.DaemonLong = st.Version
+	}
+	if versionArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(out)
+	}
+	outln(out.Long + out.DaemonLong)
+	return nil
+}
+
+// compareVersionRE matches the versions accepted by --compare: a numeric
+// major.minor or major.minor.patch version with an optional leading "v" and
+// build suffix.
+var compareVersionRE = regexp.MustCompile(`^v?[0-9]+\.[0-9]+(\.[0-9]+)?([-+].*)?$`)
+
+// runVersionCompare prints how the client version compares to the version
+// given with --compare, and with --compare-exit-code, exits with a status
+// encoding it.
+func runVersionCompare() error {
+	if versionArgs.daemon || versionArgs.upstream || versionArgs.upgradeAvailable || versionArgs.verbose {
+		return errors.New("cannot specify --compare with --daemon, --upstream, --upgrade-available or --verbose")
+	}
+	if !compareVersionRE.MatchString(versionArgs.compare) {
+		return fmt.Errorf("invalid --compare version %q; want a version like 1.56.0", versionArgs.compare)
+	}
+	cur := version.Short()
+	rel := versionRelation(cur, versionArgs.compare)
+	if versionArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		if err := e.Encode(struct {
+			SchemaVersion int    `json:"schemaVersion"` // versionJSONSchemaVersion
+			Short         string `json:"short"`
+			Compare       string `json:"compare"`
+			Relation      string `json:"relation"` // "older", "same" or "newer"
+		}{versionJSONSchemaVersion, cur, versionArgs.compare, rel}); err != nil {
+			return err
+		}
+	} else {
+		outln(rel)
+	}
+	if versionArgs.compareExitCode {
+		switch rel {
+		case "older":
+			os.Exit(2)
+		case "newer":
+			os.Exit(3)
+		}
 	}
 	return nil
 }
+
+// versionRelation reports whether version v is "older" than, the "same" as, or
+// "newer" than version other, comparing them like "tailscale update" does.
+func versionRelation(v, other string) string {
+	switch c := clientupdate.CompareVersions(v, other); {
+	case c < 0:
+		return "older"
+	case c > 0:
+		return "newer"
+	}
+	return "same"
+}
+
+// isTailscaledConnectError reports whether err is from failing to connect to
+// tailscaled at all, as opposed to an error returned by a running daemon.
+func isTailscaledConnectError(err error) bool {
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// releaseDetails returns the track, if explicitly chosen, and the release date
+// and package SHA-256 of rel, if the pkgs server provided them, formatted to
+// follow its version, like " (unstable track, released 2024-01-02, sha256
+// abcd...)". It returns "" if none of them are known.
+func releaseDetails(rel *clientupdate.Release, track string) string {
+	var details []string
+	if track != "" {
+		details = append(details, track+" track")
+	}
+	if !rel.Date.IsZero() {
+		details = append(details, "released "+rel.Date.Format(time.DateOnly))
+	}
+	if rel.SHA256 != "" {
+		details = append(details, "sha256 "+rel.SHA256)
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+// autoUpdateStatus is the "autoUpdate" object in "tailscale version --json
+// --daemon", from the node's AutoUpdatePrefs.
+type autoUpdateStatus struct {
+	// Enabled is whether tailscaled installs updates in the background.
+	Enabled bool `json:"enabled"`
+	// Check is whether tailscaled checks for updates in the background
+	// and notifies about them.
+	Check bool `json:"check"`
+}
+
+func getAutoUpdateStatus(p ipn.AutoUpdatePrefs) *autoUpdateStatus {
+	apply, _ := p.Apply.Get() // unset means off
+	return &autoUpdateStatus{Enabled: apply, Check: p.Check}
+}
+
+// buildEnv describes the environment the CLI was built for and runs in, for
+// "tailscale version --json" and --verbose.
+type buildEnv struct {
+	GoVersion string   `json:"goVersion,omitempty"`
+	OS        string   `json:"os,omitempty"`
+	Arch      string   `json:"arch,omitempty"`
+	Distro    string   `json:"distro,omitempty"`
+	BuildTags []string `json:"buildTags,omitempty"`
+}
+
+func getBuildEnv() buildEnv {
+	be := buildEnv{
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Distro:    string(distro.Get()),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "-tags" && s.Value != "" {
+				be.BuildTags = strings.Split(s.Value, ",")
+			}
+		}
+	}
+	return be
+}
+
+// majorMinor returns the "major.minor" prefix of the version v, like "1.56"
+// for "1.56.1-t0123456789-g0123456789".
+func majorMinor(v string) string {
+	v, _, _ = strings.Cut(v, "-")
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return v
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// versionsMismatch reports whether the client and daemon versions differ in
+// their major or minor version. Patch releases are compatible, so differences
+// there are not reported.
+func versionsMismatch(client, daemon string) bool {
+	return majorMinor(client) != majorMinor(daemon)
+}
+
+// checkUpgradeAvailable compares the running version with the latest one on
+// the track that "tailscale update" would use, honoring the update config
+// file.
+func checkUpgradeAvailable(ctx context.Context) (*clientupdate.CheckResult, error) {
+	pkgsAddr, err := updatePkgsAddr()
+	if err != nil {
+		return nil, err
+	}
+	tlsConf, err := updateTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := clientupdate.ParseProxyURL(updateArgs.proxy)
+	if err != nil {
+		return nil, err
+	}
+	sourceAddr, err := clientupdate.ParseSourceAddr(updateArgs.sourceAddr)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := clientupdate.ReadConfig(clientupdate.DefaultConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	upArgs, err := cfg.Apply(clientupdate.Arguments{
+		Context:    ctx,
+		PkgsAddr:   pkgsAddr,
+		TLSConfig:  tlsConf,
+		Proxy:      proxy,
+		SourceAddr: sourceAddr,
+		NoCache:    versionArgs.noCache,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clientupdate.CheckForUpdate(upArgs)
+}
+
+// daemonUpgradeCheck returns the result of --upgrade-available for the client
+// version cur from the latest version that the daemon with status st last
+// heard of, or nil if it hasn't heard of one, like when auto-update checks
+// are turned off.
+func daemonUpgradeCheck(cur string, st *ipnstate.Status) *clientupdate.CheckResult {
+	cv := st.ClientVersion
+	if cv == nil {
+		return nil
+	}
+	latest := cv.LatestVersion
+	if cv.RunningLatest {
+		// The daemon is running the latest version itself.
+		latest, _, _ = strings.Cut(st.Version, "-")
+	}
+	if latest == "" {
+		return nil
+	}
+	return &clientupdate.CheckResult{
+		Current:         cur,
+		Latest:          latest,
+		UpdateAvailable: clientupdate.CompareVersions(cur, latest) < 0,
+	}
+}
+
+// latestDetails describes where check.Latest came from, for the "Latest:"
+// line of the output.
+func latestDetails(check *clientupdate.CheckResult, latestSource string) string {
+	if latestSource == "daemon" {
+		return "as last heard of by tailscaled"
+	}
+	return check.Track + " track"
+}
+
+// exitIfUpgradeAvailable exits with status 2 if check reports a newer
+// version, like "tailscale update --check".
+func exitIfUpgradeAvailable(check *clientupdate.CheckResult) {
+	if check != nil && check.UpdateAvailable {
+		os.Exit(2)
+	}
+}
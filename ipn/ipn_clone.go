@@ -139,6 +139,7 @@ func (src *ServeConfig) Clone() *ServeConfig {
 		}
 	}
 	dst.AllowFunnel = maps.Clone(src.AllowFunnel)
+	dst.PausedFunnel = maps.Clone(src.PausedFunnel)
 	if dst.Foreground != nil {
 		dst.Foreground = map[string]*ServeConfig{}
 		for k, v := range src.Foreground {
@@ -154,12 +155,13 @@ func (src *ServeConfig) Clone() *ServeConfig {
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServeConfigCloneNeedsRegeneration = ServeConfig(struct {
-	TCP         map[uint16]*TCPPortHandler
-	Web         map[HostPort]*WebServerConfig
-	Services    map[tailcfg.ServiceName]*ServiceConfig
-	AllowFunnel map[HostPort]bool
-	Foreground  map[string]*ServeConfig
-	ETag        string
+	TCP          map[uint16]*TCPPortHandler
+	Web          map[HostPort]*WebServerConfig
+	Services     map[tailcfg.ServiceName]*ServiceConfig
+	AllowFunnel  map[HostPort]bool
+	PausedFunnel map[HostPort]bool
+	Foreground   map[string]*ServeConfig
+	ETag         string
 }{})
 
 // Clone makes a deep copy of ServiceConfig.
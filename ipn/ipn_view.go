@@ -271,6 +271,10 @@ func (v ServeConfigView) AllowFunnel() views.Map[HostPort, bool] {
 	return views.MapOf(v.ж.AllowFunnel)
 }
 
+func (v ServeConfigView) PausedFunnel() views.Map[HostPort, bool] {
+	return views.MapOf(v.ж.PausedFunnel)
+}
+
 func (v ServeConfigView) Foreground() views.MapFn[string, *ServeConfig, ServeConfigView] {
 	return views.MapFnOf(v.ж.Foreground, func(t *ServeConfig) ServeConfigView {
 		return t.View()
@@ -280,12 +284,13 @@ func (v ServeConfigView) ETag() string { return v.ж.ETag }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServeConfigViewNeedsRegeneration = ServeConfig(struct {
-	TCP         map[uint16]*TCPPortHandler
-	Web         map[HostPort]*WebServerConfig
-	Services    map[tailcfg.ServiceName]*ServiceConfig
-	AllowFunnel map[HostPort]bool
-	Foreground  map[string]*ServeConfig
-	ETag        string
+	TCP          map[uint16]*TCPPortHandler
+	Web          map[HostPort]*WebServerConfig
+	Services     map[tailcfg.ServiceName]*ServiceConfig
+	AllowFunnel  map[HostPort]bool
+	PausedFunnel map[HostPort]bool
+	Foreground   map[string]*ServeConfig
+	ETag         string
 }{})
 
 // View returns a read-only view of ServiceConfig.
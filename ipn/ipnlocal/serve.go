@@ -418,7 +418,7 @@ func (b *LocalBackend) HandleIngressTCPConn(ingressPeer tailcfg.NodeView, target
 				logf("getConn didn't complete from %v to port %v", srcAddr, dport)
 				return
 			}
-			handler(c)
+			handler(b.trackFunnelConn(c, ingressPeer, target, srcAddr))
 			return
 		}
 	}
@@ -436,7 +436,58 @@ func (b *LocalBackend) HandleIngressTCPConn(ingressPeer tailcfg.NodeView, target
 		logf("getConn didn't complete from %v to port %v", srcAddr, dport)
 		return
 	}
-	handler(c)
+	handler(b.trackFunnelConn(c, ingressPeer, target, srcAddr))
+}
+
+// trackedFunnelConn is a Funnel connection that is reported by
+// LocalBackend.FunnelConns until it's closed.
+type trackedFunnelConn struct {
+	net.Conn
+	closeOnce sync.Once
+	untrack   func()
+}
+
+func (c *trackedFunnelConn) Close() error {
+	c.closeOnce.Do(c.untrack)
+	return c.Conn.Close()
+}
+
+// trackFunnelConn returns c, from src to target through ingressPeer, wrapped
+// so that it's reported by FunnelConns until it's closed. The serve handlers
+// may return before the connection is done, like the HTTP ones, so it can't
+// be untracked when they return.
+func (b *LocalBackend) trackFunnelConn(c net.Conn, ingressPeer tailcfg.NodeView, target ipn.HostPort, src netip.AddrPort) net.Conn {
+	ac := ipn.ActiveFunnelConn{
+		Src:    src,
+		Target: target,
+		Start:  b.clock.Now(),
+	}
+	if ingressPeer.Valid() {
+		ac.IngressNode = ingressPeer.Name()
+	}
+	b.mu.Lock()
+	h := b.funnelConns.Add(ac)
+	b.mu.Unlock()
+	return &trackedFunnelConn{Conn: c, untrack: func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.funnelConns, h)
+	}}
+}
+
+// FunnelConns returns the Funnel connections that the node is currently
+// handling, oldest first.
+func (b *LocalBackend) FunnelConns() []ipn.ActiveFunnelConn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conns := make([]ipn.ActiveFunnelConn, 0, len(b.funnelConns))
+	for _, c := range b.funnelConns {
+		conns = append(conns, c)
+	}
+	slices.SortFunc(conns, func(a, b ipn.ActiveFunnelConn) int {
+		return a.Start.Compare(b.Start)
+	})
+	return conns
 }
 
 // tcpHandlerForVIPService returns a handler for a TCP connection to a VIP service
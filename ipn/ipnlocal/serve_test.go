@@ -13,6 +13,7 @@
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
@@ -1060,3 +1061,34 @@ func TestEncTailscaleHeaderValue(t *testing.T) {
 		}
 	}
 }
+
+func TestFunnelConns(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := tstest.NewClock(tstest.ClockOpts{Start: start})
+	b := &LocalBackend{clock: clock}
+	ingress := (&tailcfg.Node{Name: "ingress.example.ts.net."}).View()
+
+	c1, _ := net.Pipe()
+	tc1 := b.trackFunnelConn(c1, ingress, "foo.ts.net:443", netip.MustParseAddrPort("203.0.113.1:1234"))
+	clock.Advance(time.Second)
+	c2, _ := net.Pipe()
+	tc2 := b.trackFunnelConn(c2, ingress, "foo.ts.net:8443", netip.MustParseAddrPort("203.0.113.2:5678"))
+
+	want := []ipn.ActiveFunnelConn{
+		{Src: netip.MustParseAddrPort("203.0.113.1:1234"), Target: "foo.ts.net:443", IngressNode: "ingress.example.ts.net.", Start: start},
+		{Src: netip.MustParseAddrPort("203.0.113.2:5678"), Target: "foo.ts.net:8443", IngressNode: "ingress.example.ts.net.", Start: start.Add(time.Second)},
+	}
+	if got := b.FunnelConns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FunnelConns = %+v; want %+v", got, want)
+	}
+
+	tc1.Close()
+	tc1.Close() // closing again must not untrack anything else
+	if got := b.FunnelConns(); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("after closing the first, FunnelConns = %+v; want %+v", got, want[1:])
+	}
+	tc2.Close()
+	if got := b.FunnelConns(); len(got) != 0 {
+		t.Errorf("after closing both, FunnelConns = %+v; want none", got)
+	}
+}
@@ -334,6 +334,33 @@ func TestServeWatchIPNBus(t *testing.T) {
 	}
 }
 
+func TestServeFunnelConnsPermissions(t *testing.T) {
+	b := newTestLocalBackend(t)
+	tests := []struct {
+		desc        string
+		permitRead  bool
+		permitWrite bool
+		wantStatus  int
+	}{
+		{desc: "read-only", permitRead: true, wantStatus: http.StatusForbidden},
+		{desc: "read-write", permitRead: true, permitWrite: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			h := &Handler{
+				PermitRead:  tt.permitRead,
+				PermitWrite: tt.permitWrite,
+				b:           b,
+			}
+			rec := httptest.NewRecorder()
+			h.serveFunnelConns(rec, httptest.NewRequest("GET", "/localapi/v0/funnel-conns", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
 func newTestLocalBackend(t testing.TB) *ipnlocal.LocalBackend {
 	var logf logger.Logf = logger.Discard
 	sys := new(tsd.System)
@@ -13,6 +13,7 @@
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
@@ -63,6 +64,12 @@ type ServeConfig struct {
 	// traffic is allowed, from trusted ingress peers.
 	AllowFunnel map[HostPort]bool `json:",omitempty"`
 
+	// PausedFunnel is the set of SNI:port values for which funnel was
+	// paused with "tailscale funnel <port> pause". Paused entries are not
+	// in AllowFunnel, and are only recorded here so that funnel can later
+	// be resumed for them.
+	PausedFunnel map[HostPort]bool `json:",omitempty"`
+
 	// Foreground is a map of an IPN Bus session ID to an alternate foreground serve config that's valid for the
 	// life of that WatchIPNBus session ID. This allows the config to specify ephemeral configs that are used
 	// in the CLI's foreground mode to ensure ungraceful shutdowns of either the client or the LocalBackend does not
@@ -117,6 +124,25 @@ type FunnelConn struct {
 	Src netip.AddrPort
 }
 
+// ActiveFunnelConn describes a Funnel connection that the node is currently
+// handling, as returned by the LocalAPI's funnel-conns endpoint.
+type ActiveFunnelConn struct {
+	// Src is the address of the client on the internet that initiated
+	// the connection.
+	Src netip.AddrPort
+
+	// Target is the host:port the client connected to, like
+	// "foo.tailnet.ts.net:443".
+	Target HostPort
+
+	// IngressNode is the name of the Funnel ingress node relaying the
+	// connection.
+	IngressNode string `json:",omitempty"`
+
+	// Start is when the node accepted the connection.
+	Start time.Time
+}
+
 // WebServerConfig describes a web server's configuration.
 type WebServerConfig struct {
 	Handlers map[string]*HTTPHandler // mountPoint => handler
@@ -342,6 +368,42 @@ func (sc *ServeConfig) SetFunnel(host string, port uint16, setOn bool) {
 			sc.AllowFunnel = nil
 		}
 	}
+	// Explicitly turning funnel on or off forgets any paused state.
+	sc.unpauseFunnel(hp)
+}
+
+// PauseFunnel turns off funnel for the given host and port, and records it in
+// sc.PausedFunnel so that it can later be turned back on with ResumeFunnel.
+// It reports whether funnel was on for the host and port.
+func (sc *ServeConfig) PauseFunnel(host string, port uint16) bool {
+	hp := HostPort(net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if !sc.AllowFunnel[hp] {
+		return false
+	}
+	sc.SetFunnel(host, port, false)
+	mak.Set(&sc.PausedFunnel, hp, true)
+	return true
+}
+
+// ResumeFunnel turns funnel back on for the given host and port, if it was
+// previously paused with PauseFunnel. It reports whether funnel was paused for
+// the host and port.
+func (sc *ServeConfig) ResumeFunnel(host string, port uint16) bool {
+	hp := HostPort(net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if !sc.PausedFunnel[hp] {
+		return false
+	}
+	sc.SetFunnel(host, port, true)
+	return true
+}
+
+func (sc *ServeConfig) unpauseFunnel(hp HostPort) {
+	if _, exists := sc.PausedFunnel[hp]; exists {
+		delete(sc.PausedFunnel, hp)
+		if len(sc.PausedFunnel) == 0 {
+			sc.PausedFunnel = nil
+		}
+	}
 }
 
 // RemoveWebHandler deletes the web handlers at all of the given mount points